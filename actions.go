@@ -0,0 +1,110 @@
+package rule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// Action is an outcome attached to a rule set, e.g. {"type":"discount","params":{"percent":10}}
+type Action struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// Actions is a list of actions, in JSON it can also be written as a single action object
+type Actions []Action
+
+func (a *Actions) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var action Action
+		if err := json.Unmarshal(trimmed, &action); err != nil {
+			return err
+		}
+		*a = Actions{action}
+		return nil
+	}
+	var actions []Action
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return err
+	}
+	*a = actions
+	return nil
+}
+
+// Result is the outcome of running a rule set against an input
+type Result struct {
+	Passed bool `json:"passed"`
+	// Skipped is set when the rule set was not evaluated because it is outside its effective
+	// window, it fires no actions
+	Skipped bool `json:"skipped,omitempty"`
+	// Score is the score of a rule set in scoring mode, Contributions are the rules, groups
+	// and condition sets that made it up, in the order they were evaluated
+	Score         float64        `json:"score,omitempty"`
+	Contributions []Contribution `json:"contributions,omitempty"`
+	// Actions are the fired actions: the event and actions of the rule set when it passed,
+	// its onFailure actions otherwise
+	Actions []Action `json:"actions,omitempty"`
+}
+
+// Run evaluates the program like Eval does and returns the actions fired by the outcome,
+// no actions are fired when the evaluation fails with an error
+func (p *Program) Run(input interface{}) (Result, error) {
+	return p.RunContext(context.Background(), input)
+}
+
+// RunContext runs the program like Run does, stopping like EvalContext does
+func (p *Program) RunContext(ctx context.Context, input interface{}) (Result, error) {
+	e, err := p.evaluation(ctx, input)
+	if err != nil {
+		return Result{}, err
+	}
+	return p.run(e, nil)
+}
+
+// RunExplain runs the program like Run does and returns the trace of the same evaluation,
+// like Explain does. The trace of an evaluation failing with an error is returned too.
+func (p *Program) RunExplain(input interface{}) (Result, *Trace, error) {
+	return p.RunExplainContext(context.Background(), input)
+}
+
+// RunExplainContext runs the program like RunExplain does, stopping like EvalContext does
+func (p *Program) RunExplainContext(ctx context.Context, input interface{}) (Result, *Trace, error) {
+	e, err := p.evaluation(ctx, input)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	e.slots = nil
+	t := p.trace()
+	result, err := p.run(e, t)
+	return result, t, err
+}
+
+// run evaluates the program and collects the result, recording the trace when t is set
+func (p *Program) run(e *evaluation, t *Trace) (Result, error) {
+	if p.windowed && !p.ruleSet.EffectiveAt(e.now) {
+		t.deactivate()
+		return Result{Skipped: true}, nil
+	}
+	passed, err := p.eval(e, t)
+	if err != nil {
+		return Result{}, err
+	}
+	result := p.result(passed)
+	if e.score != nil {
+		result.Score, result.Contributions = e.score.total, e.score.contributions
+	}
+	return result, nil
+}
+
+// result collects the actions fired by the outcome of the rule set
+func (p *Program) result(passed bool) Result {
+	result := Result{Passed: passed}
+	if passed {
+		result.Actions = append(result.Actions, p.ruleSet.Event...)
+		result.Actions = append(result.Actions, p.ruleSet.Actions...)
+	} else {
+		result.Actions = append(result.Actions, p.ruleSet.OnFailure...)
+	}
+	return result
+}
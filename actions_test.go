@@ -0,0 +1,90 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProgramRun(t *testing.T) {
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"total",
+				   "operator":"greaterThan",
+				   "value":100
+				}
+			 ]
+		  }
+	   ],
+	   "event":{
+		  "type":"discount",
+		  "params":{
+			 "percent":10
+		  }
+	   },
+	   "actions":[
+		  {
+			 "type":"route",
+			 "params":{
+				"queue":"priority"
+			 }
+		  }
+	   ],
+	   "onFailure":{
+		  "type":"route",
+		  "params":{
+			 "queue":"standard"
+		  }
+	   }
+	}`
+
+	program, err := Compile(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected Result
+	}{
+		{`{"total":150}`, Result{Passed: true, Actions: []Action{
+			{Type: "discount", Params: map[string]interface{}{"percent": 10.0}},
+			{Type: "route", Params: map[string]interface{}{"queue": "priority"}},
+		}}},
+		{`{"total":50}`, Result{Passed: false, Actions: []Action{
+			{Type: "route", Params: map[string]interface{}{"queue": "standard"}},
+		}}},
+	}
+
+	for _, test := range tests {
+		result, err := program.Run(test.input)
+		if err != nil {
+			t.Errorf("Run(%s) unexpected error: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Run(%s) = %+v; expected %+v", test.input, result, test.expected)
+		}
+	}
+
+	result, err := program.Run(`{}`)
+	if !errors.Is(err, ErrMissingField) || result.Actions != nil {
+		t.Errorf("Run({}) = %+v, %v; expected no actions and %v", result, err, ErrMissingField)
+	}
+}
+
+func TestActionsUnmarshalJSON(t *testing.T) {
+	var actions Actions
+	if err := json.Unmarshal([]byte(`{"type":"a"}`), &actions); err != nil || !reflect.DeepEqual(actions, Actions{{Type: "a"}}) {
+		t.Errorf("actions = %+v, %v", actions, err)
+	}
+	if err := json.Unmarshal([]byte(`[{"type":"a"},{"type":"b"}]`), &actions); err != nil || len(actions) != 2 {
+		t.Errorf("actions = %+v, %v", actions, err)
+	}
+	if err := json.Unmarshal([]byte(`"a"`), &actions); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,209 @@
+package rule
+
+import (
+	"testing"
+	"time"
+)
+
+const benchmarkInput = `{
+	"country": "Turkey",
+	"city": "Istanbul",
+	"district": "Kadikoy",
+	"population": 20000,
+	"language": "Turkish"
+}`
+
+const benchmarkRules = `{
+	"conditions": [
+		{
+			"all": [
+				{"field": "country", "operator": "equals", "value": "Turkey"},
+				{"field": "city", "operator": "in", "value": ["Istanbul", "Ankara"]},
+				{"field": "population", "operator": "greaterThan", "value": 1000}
+			],
+			"any": [
+				{"field": "district", "operator": "startsWith", "value": "Bes"},
+				{"field": "language", "operator": "equals", "value": "Turkish"}
+			]
+		},
+		{
+			"none": [
+				{"field": "country", "operator": "equals", "value": "Germany"}
+			]
+		}
+	]
+}`
+
+// benchmarkStruct is the benchmark input as a struct
+type benchmarkStruct struct {
+	Country    string `json:"country"`
+	City       string `json:"city"`
+	District   string `json:"district"`
+	Population int    `json:"population"`
+	Language   string `json:"language"`
+}
+
+// benchmarkAccessor is the benchmark input with the accessor cmd/rulegen generates
+type benchmarkAccessor benchmarkStruct
+
+func (x benchmarkAccessor) RuleField(name string) (interface{}, bool) {
+	switch name {
+	case "city":
+		return x.City, true
+	case "country":
+		return x.Country, true
+	case "district":
+		return x.District, true
+	case "language":
+		return x.Language, true
+	case "population":
+		return x.Population, true
+	}
+	return nil, false
+}
+
+var benchmarkStructInput = benchmarkStruct{
+	Country:    "Turkey",
+	City:       "Istanbul",
+	District:   "Kadikoy",
+	Population: 20000,
+	Language:   "Turkish",
+}
+
+// sleepOperation is a custom operator standing for a lookup doing I/O
+type sleepOperation struct{}
+
+func (o sleepOperation) Execute(input, value interface{}) interface{} {
+	time.Sleep(time.Millisecond)
+	return input == value
+}
+
+const benchmarkSlowRules = `{
+	"conditions": [
+		{"all": [
+			{"field": "country", "operator": "custom.lookup", "value": "Turkey"},
+			{"field": "city", "operator": "custom.lookup", "value": "Istanbul"}
+		]},
+		{"all": [
+			{"field": "district", "operator": "custom.lookup", "value": "Kadikoy"},
+			{"field": "language", "operator": "custom.lookup", "value": "Turkish"}
+		]}
+	]
+}`
+
+func BenchmarkExecute(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Execute(benchmarkInput, benchmarkRules, nil)
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	program, err := Compile(benchmarkRules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	obj, err := parseInput(benchmarkInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		program.Eval(obj)
+	}
+}
+
+func BenchmarkProgramEvalStruct(b *testing.B) {
+	program, err := Compile(benchmarkRules)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		program.Eval(&benchmarkStructInput)
+	}
+}
+
+func BenchmarkProgramEvalAccessor(b *testing.B) {
+	program, err := Compile(benchmarkRules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	input := benchmarkAccessor(benchmarkStructInput)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		program.Eval(input)
+	}
+}
+
+func BenchmarkProgramEvalParallel(b *testing.B) {
+	program, err := Compile(benchmarkRules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	obj, err := parseInput(benchmarkInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			program.Eval(obj)
+		}
+	})
+}
+
+func BenchmarkCheckConditionSet(b *testing.B) {
+	obj, err := parseInput(benchmarkInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+	conditionSet := ConditionSet{
+		All: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}},
+		Any: []Rule{{Field: "language", Operator: "equals", Value: "Turkish"}},
+	}
+	conditionSetChecker := ConditionSetChecker{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conditionSetChecker.CheckConditionSet(obj.(map[string]interface{}), conditionSet, nil)
+	}
+}
+
+func BenchmarkProgramEvalWithIO(b *testing.B) {
+	obj, err := parseInput(benchmarkInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+	custom := map[string]CustomOperation{"lookup": sleepOperation{}}
+
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"sequential", []Option{WithCustom(custom)}},
+		{"parallelism=4", []Option{WithCustom(custom), WithParallelism(4)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			program, err := Compile(benchmarkSlowRules, bench.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				program.Eval(obj)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+
+	"github.com/nurettintopal/rule"
+)
+
+// convert writes a rule document in another format
+func (c *command) convert(args []string) int {
+	fs := c.flags("convert", "RULES")
+	from := fs.String("from", "", "format of the rule document, default from the file extension")
+	to := fs.String("to", "", "format to convert to, default from the extension of -o")
+	output := fs.String("o", "", "output file, default stdout")
+	if status, ok := c.parse(fs, args, 1, 1); !ok {
+		return status
+	}
+
+	path := fs.Arg(0)
+	source := compileOptions{format: *from}
+	sourceFormat, err := source.documentFormat(path)
+	if err != nil {
+		return c.errorf("%v", err)
+	}
+	target := rule.Format(*to)
+	if target == "" {
+		if *output == "" {
+			return c.errorf("convert: -to or -o is required")
+		}
+		if target, err = rule.FormatOf(*output); err != nil {
+			return c.errorf("%v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c.errorf("%v", err)
+	}
+	ruleSet, err := rule.ParseRuleSet(data, sourceFormat)
+	if err != nil {
+		return c.errorf("%s: %v", path, err)
+	}
+	converted, err := rule.MarshalRuleSet(ruleSet, target)
+	if err != nil {
+		return c.errorf("%s: %v", path, err)
+	}
+	if len(converted) > 0 && converted[len(converted)-1] != '\n' {
+		converted = append(converted, '\n')
+	}
+
+	if *output == "" {
+		if _, err := c.stdout.Write(converted); err != nil {
+			return c.errorf("%v", err)
+		}
+		return exitOK
+	}
+	if err := os.WriteFile(*output, converted, 0o644); err != nil {
+		return c.errorf("%v", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nurettintopal/rule"
+)
+
+// eval evaluates every input of a JSON or NDJSON stream against a rule document
+func (c *command) eval(args []string) int {
+	fs := c.flags("eval", "RULES [INPUT]")
+	var compile compileOptions
+	compile.register(fs)
+	explain := fs.Bool("explain", false, "print the trace of every input")
+	asJSON := fs.Bool("json", false, "print a JSON result, or a JSON trace with -explain, per line")
+	quiet := fs.Bool("q", false, "print nothing, only set the exit status")
+	if status, ok := c.parse(fs, args, 1, 2); !ok {
+		return status
+	}
+
+	program, err := c.compile(fs.Arg(0), &compile)
+	if err != nil {
+		return c.errorf("%s: %v", fs.Arg(0), err)
+	}
+
+	input := c.stdin
+	name := "stdin"
+	if path := fs.Arg(1); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return c.errorf("%v", err)
+		}
+		defer file.Close()
+		input, name = file, path
+	}
+
+	status := exitOK
+	// numbers are decoded as float64 like the inputs of rule.Evaluate, so strict comparisons
+	// with the numbers of the rules hold
+	decoder := json.NewDecoder(input)
+	for n := 1; ; n++ {
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return c.errorf("%s: input %d: %v", name, n, err)
+		}
+
+		passed, output, err := c.evalInput(program, obj, *explain, *asJSON)
+		if output != "" && !*quiet {
+			fmt.Fprintln(c.stdout, output)
+		}
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return c.errorf("%v", ctxErr)
+			}
+			c.errorf("%s: input %d: %v", name, n, err)
+			status = exitError
+			continue
+		}
+		if !passed && status == exitOK {
+			status = exitFailed
+		}
+	}
+	return status
+}
+
+// evalInput evaluates a single input and renders its outcome, the trace of an input that
+// fails with an error is rendered too since it shows the rule that failed
+func (c *command) evalInput(program *rule.Program, obj map[string]interface{}, explain, asJSON bool) (bool, string, error) {
+	if explain {
+		trace, err := program.ExplainContext(c.ctx, obj)
+		if !asJSON {
+			return trace.Result, strings.TrimSuffix(trace.String(), "\n"), err
+		}
+		data, jsonErr := json.Marshal(trace)
+		if jsonErr != nil {
+			return false, "", jsonErr
+		}
+		return trace.Result, string(data), err
+	}
+
+	result, err := program.RunContext(c.ctx, obj)
+	if err != nil {
+		return false, "", err
+	}
+	if !asJSON {
+		status := "fail"
+		switch {
+		case result.Passed:
+			status = "pass"
+		case result.Skipped:
+			status = "skip"
+		}
+		if program.RuleSet().Scoring != nil && !result.Skipped {
+			status += fmt.Sprintf(" (score %g)", result.Score)
+		}
+		return result.Passed, status, nil
+	}
+	data, err := json.Marshal(result)
+	return result.Passed, string(data), err
+}
+
+// compile reads and compiles a rule document
+func (c *command) compile(path string, compile *compileOptions) (*rule.Program, error) {
+	format, err := compile.documentFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := compile.options()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return rule.CompileDocument(data, format, opts...)
+}
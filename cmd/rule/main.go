@@ -0,0 +1,164 @@
+// Command rule evaluates, validates and converts rule documents.
+//
+//	rule eval [flags] RULES [INPUT]     evaluate inputs, one JSON object or NDJSON, stdin by default
+//	rule validate [flags] RULES...      report the errors and warnings of rule documents
+//	rule lint [flags] RULES...          like validate, warnings fail too
+//	rule convert [flags] RULES          convert a rule document to another format
+//	rule test [flags] TESTS...          run the test cases of test files or directories
+//
+// The exit status is 0 on success, 1 when an input failed the rules, a document is invalid
+// or a test case failed, and 2 on errors, e.g. unreadable files, rules that do not compile
+// or bad inputs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nurettintopal/rule"
+)
+
+// Exit statuses
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+const usage = `usage: rule <command> [flags] [arguments]
+
+commands:
+  eval      evaluate inputs against a rule document
+  validate  report the errors and warnings of rule documents
+  lint      like validate, warnings fail too
+  convert   convert a rule document to another format
+  test      run the test cases of test files, or of the *.test.* files of directories
+
+run "rule <command> -h" for the flags of a command
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	status := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(status)
+}
+
+// command is the environment a command runs in
+type command struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// run runs the command of the arguments and returns the exit status
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	c := &command{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr}
+	switch args[0] {
+	case "eval":
+		return c.eval(args[1:])
+	case "validate":
+		return c.validate(args[1:], false)
+	case "lint":
+		return c.validate(args[1:], true)
+	case "convert":
+		return c.convert(args[1:])
+	case "test":
+		return c.test(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "rule: unknown command %q\n\n%s", args[0], usage)
+	return exitError
+}
+
+// flags returns the flag set of a command, it reports errors to stderr
+func (c *command) flags(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: rule %s [flags] %s\n\nflags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command, it returns false with the exit status when the
+// command must not run
+func (c *command) parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitError, false
+	}
+	if fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs) {
+		fs.Usage()
+		return exitError, false
+	}
+	return exitOK, true
+}
+
+// errorf reports an error and returns the error exit status
+func (c *command) errorf(format string, args ...interface{}) int {
+	fmt.Fprintf(c.stderr, "rule: "+format+"\n", args...)
+	return exitError
+}
+
+// compileOptions are the flags changing how rules are compiled
+type compileOptions struct {
+	format string
+	schema string
+	strict bool
+}
+
+func (o *compileOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "", "format of the rule documents: json, yaml, toml or expression, default from the file extension")
+	o.registerChecks(fs)
+}
+
+// registerChecks registers the flags of the checks of the rules only
+func (o *compileOptions) registerChecks(fs *flag.FlagSet) {
+	fs.StringVar(&o.schema, "schema", "", "JSON Schema file the fields and values of the rules are checked against")
+	fs.BoolVar(&o.strict, "strict", false, "compare values without converting between types")
+}
+
+// documentFormat returns the format of a rule document
+func (o *compileOptions) documentFormat(path string) (rule.Format, error) {
+	if o.format != "" {
+		return rule.Format(o.format), nil
+	}
+	return rule.FormatOf(path)
+}
+
+// options returns the compile options of the flags
+func (o *compileOptions) options() ([]rule.Option, error) {
+	var opts []rule.Option
+	if o.strict {
+		opts = append(opts, rule.WithStrictTypes())
+	}
+	if o.schema != "" {
+		data, err := os.ReadFile(o.schema)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := rule.SchemaFromJSONSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.schema, err)
+		}
+		opts = append(opts, rule.WithSchema(schema))
+	}
+	return opts, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRules = `conditions:
+  - all:
+      - field: country
+        operator: equals
+        value: Turkey
+      - field: population
+        operator: greaterThan
+        value: 1000
+`
+
+// writeFile writes a file into a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCommand runs the command line tool with the input on stdin
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestEval(t *testing.T) {
+	rules := writeFile(t, "rules.yaml", testRules)
+	inputs := `{"country": "Turkey", "population": 5000}
+{"country": "Germany", "population": 5000}
+`
+
+	status, stdout, stderr := runCommand(inputs, "eval", rules)
+	if status != exitFailed || stdout != "pass\nfail\n" || stderr != "" {
+		t.Errorf("eval = %d, %q, %q; expected a pass, a fail and status %d", status, stdout, stderr, exitFailed)
+	}
+
+	status, stdout, _ = runCommand(`{"country": "Turkey", "population": 5000}`, "eval", "-json", rules)
+	if status != exitOK || stdout != "{\"passed\":true}\n" {
+		t.Errorf("eval -json = %d, %q; expected a JSON result", status, stdout)
+	}
+
+	status, stdout, _ = runCommand(`{"country": "Turkey", "population": 5}`, "eval", "-explain", rules)
+	if status != exitFailed || !strings.Contains(stdout, "FAIL  population greaterThan 1000 (actual 5)") {
+		t.Errorf("eval -explain = %d, %q; expected the trace", status, stdout)
+	}
+
+	// strict comparisons hold for the numbers of the input
+	strictRules := map[string]string{
+		"rules.yaml": testRules,
+		"rules.json": `{"conditions":[{"all":[{"field":"population","operator":"equals","value":20000}]}]}`,
+	}
+	for name, content := range strictRules {
+		status, stdout, stderr := runCommand(`{"country": "Turkey", "population": 20000}`, "eval", "-strict", writeFile(t, name, content))
+		if status != exitOK || stdout != "pass\n" {
+			t.Errorf("eval -strict %s = %d, %q, %q; expected a pass", name, status, stdout, stderr)
+		}
+	}
+
+	input := writeFile(t, "input.json", `{"country": "Turkey", "population": 5000}`)
+	if status, stdout, _ := runCommand("", "eval", "-q", rules, input); status != exitOK || stdout != "" {
+		t.Errorf("eval -q with an input file = %d, %q; expected status %d and no output", status, stdout, exitOK)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	rules := writeFile(t, "rules.yaml", testRules)
+
+	status, stdout, stderr := runCommand(`{"country": "Turkey"}`+"\n"+`{"country": "Turkey", "population": 5000}`, "eval", rules)
+	if status != exitError || stdout != "pass\n" || !strings.Contains(stderr, "input 1") {
+		t.Errorf("eval = %d, %q, %q; expected the error of the first input and the result of the second", status, stdout, stderr)
+	}
+
+	if status, _, stderr := runCommand(`{"country": `, "eval", rules); status != exitError || stderr == "" {
+		t.Errorf("eval of malformed input = %d, %q; expected status %d", status, stderr, exitError)
+	}
+
+	broken := writeFile(t, "broken.json", `{"conditions": [{"all": [{"field": "a", "operator": "nope", "value": 1}]}]}`)
+	if status, _, stderr := runCommand("", "eval", broken); status != exitError || !strings.Contains(stderr, "nope") {
+		t.Errorf("eval of broken rules = %d, %q; expected status %d", status, stderr, exitError)
+	}
+
+	if status, _, _ := runCommand("", "eval"); status != exitError {
+		t.Errorf("eval without rules = %d; expected status %d", status, exitError)
+	}
+	if status, _, _ := runCommand("", "unknown"); status != exitError {
+		t.Errorf("unknown command = %d; expected status %d", status, exitError)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := writeFile(t, "valid.yaml", testRules)
+	duplicated := writeFile(t, "duplicated.json", `{"conditions": [{"all": [
+		{"field": "country", "operator": "equals", "value": "Turkey"},
+		{"field": "country", "operator": "equals", "value": "Turkey"}
+	]}]}`)
+	broken := writeFile(t, "broken.json", `{"conditions": [{"all": [{"field": "a", "operator": "nope", "value": 1}]}]}`)
+
+	if status, stdout, _ := runCommand("", "validate", valid); status != exitOK || stdout != "" {
+		t.Errorf("validate = %d, %q; expected no diagnostics", status, stdout)
+	}
+
+	status, stdout, _ := runCommand("", "validate", duplicated)
+	if status != exitOK || !strings.Contains(stdout, "warning: conditions[0].all[1]: duplicates conditions[0].all[0]") {
+		t.Errorf("validate = %d, %q; expected a warning", status, stdout)
+	}
+	if status, _, _ := runCommand("", "lint", duplicated); status != exitFailed {
+		t.Errorf("lint = %d; expected warnings to fail", status)
+	}
+
+	status, stdout, _ = runCommand("", "validate", valid, broken)
+	if status != exitFailed || !strings.Contains(stdout, broken+": error: conditions[0].all[0]:") {
+		t.Errorf("validate = %d, %q; expected an error", status, stdout)
+	}
+
+	schema := writeFile(t, "schema.json", `{"type": "object", "properties": {"country": {"type": "string"}}}`)
+	status, stdout, _ = runCommand("", "validate", "-schema", schema, valid)
+	if status != exitFailed || !strings.Contains(stdout, "population") {
+		t.Errorf("validate -schema = %d, %q; expected an unknown field error", status, stdout)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rules := writeFile(t, "rules.yaml", testRules)
+
+	status, stdout, stderr := runCommand("", "convert", "-to", "expression", rules)
+	if status != exitOK || stdout != "country == \"Turkey\" and population > 1000\n" {
+		t.Errorf("convert = %d, %q, %q; expected an expression", status, stdout, stderr)
+	}
+
+	output := filepath.Join(t.TempDir(), "rules.json")
+	if status, _, stderr := runCommand("", "convert", "-o", output, rules); status != exitOK {
+		t.Fatalf("convert -o = %d, %q; expected status %d", status, stderr, exitOK)
+	}
+	if status, stdout, _ := runCommand(`{"country": "Turkey", "population": 5000}`, "eval", output); status != exitOK || stdout != "pass\n" {
+		t.Errorf("eval of the converted rules = %d, %q; expected a pass", status, stdout)
+	}
+
+	if status, _, _ := runCommand("", "convert", rules); status != exitError {
+		t.Errorf("convert without a format = %d; expected status %d", status, exitError)
+	}
+}
+
+func TestTest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rules.yaml": testRules,
+		"rules.test.yaml": `rules: rules.yaml
+tests:
+  - name: passes
+    input: {country: Turkey, population: 5000}
+    passed: true
+`,
+		"failing.test.json": `{"rules": "rules.yaml", "tests": [
+			{"name": "fails", "input": {"country": "Turkey", "population": 5}, "passed": true}
+		]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, stdout, stderr := runCommand("", "test", "-v", filepath.Join(dir, "rules.test.yaml"))
+	if status != exitOK || !strings.Contains(stdout, "--- PASS: passes") || !strings.Contains(stdout, "ok\t") {
+		t.Errorf("test = %d, %q, %q; expected the case to pass", status, stdout, stderr)
+	}
+
+	junit := filepath.Join(t.TempDir(), "report.xml")
+	status, stdout, _ = runCommand("", "test", "-junit", junit, dir)
+	if status != exitFailed || !strings.Contains(stdout, "--- FAIL: fails") || !strings.Contains(stdout, "- PASS  rule set\n    + FAIL  rule set") {
+		t.Errorf("test = %d, %q; expected the failure with the trace diff", status, stdout)
+	}
+	report, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatalf("expected a JUnit report: %v", err)
+	}
+	if !strings.Contains(string(report), `<testsuites tests="2" failures="1">`) {
+		t.Errorf("report = %s; expected two tests and a failure", report)
+	}
+
+	if status, _, _ := runCommand("", "test", filepath.Join(dir, "missing.test.yaml")); status != exitError {
+		t.Errorf("test of a missing file = %d; expected status %d", status, exitError)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurettintopal/rule"
+)
+
+// test runs the test cases of test files
+func (c *command) test(args []string) int {
+	flags := c.flags("test", "TESTS...")
+	var compile compileOptions
+	compile.registerChecks(flags)
+	junit := flags.String("junit", "", "write a JUnit XML report to the file")
+	verbose := flags.Bool("v", false, "print every test case")
+	if status, ok := c.parse(flags, args, 1, -1); !ok {
+		return status
+	}
+
+	opts, err := compile.options()
+	if err != nil {
+		return c.errorf("%v", err)
+	}
+	paths, err := testFiles(flags.Args())
+	if err != nil {
+		return c.errorf("%v", err)
+	}
+
+	status := exitOK
+	var suites []*rule.TestSuite
+	for _, path := range paths {
+		suite, err := rule.RunTestFile(path, opts...)
+		if err != nil {
+			c.errorf("%v", err)
+			status = exitError
+			continue
+		}
+		suites = append(suites, suite)
+		if suite.Failures() > 0 && status == exitOK {
+			status = exitFailed
+		}
+		c.report(suite, *verbose)
+	}
+
+	if *junit != "" {
+		file, err := os.Create(*junit)
+		if err != nil {
+			return c.errorf("%v", err)
+		}
+		defer file.Close()
+		if err := rule.WriteJUnit(file, suites...); err != nil {
+			return c.errorf("%v", err)
+		}
+	}
+	return status
+}
+
+// report prints the outcome of a suite like go test does
+func (c *command) report(suite *rule.TestSuite, verbose bool) {
+	for _, tc := range suite.Cases {
+		switch {
+		case tc.Failure != "":
+			fmt.Fprintf(c.stdout, "--- FAIL: %s\n", tc.Name)
+			for _, line := range strings.Split(strings.TrimRight(tc.Failure, "\n"), "\n") {
+				if line == "" {
+					fmt.Fprintln(c.stdout)
+					continue
+				}
+				fmt.Fprintf(c.stdout, "    %s\n", line)
+			}
+		case verbose:
+			fmt.Fprintf(c.stdout, "--- PASS: %s\n", tc.Name)
+		}
+	}
+	if failures := suite.Failures(); failures > 0 {
+		fmt.Fprintf(c.stdout, "FAIL\t%s\t%d of %d failed\n", suite.Name, failures, len(suite.Cases))
+		return
+	}
+	fmt.Fprintf(c.stdout, "ok\t%s\t%d passed\n", suite.Name, len(suite.Cases))
+}
+
+// testFiles returns the test files of the arguments, the files of a directory whose name
+// contains ".test." are test files
+func testFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.Contains(entry.Name(), ".test.") {
+				if format, err := rule.FormatOf(path); err == nil && format != rule.FormatExpression {
+					paths = append(paths, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nurettintopal/rule"
+)
+
+// validate reports the diagnostics of rule documents, lint also fails on warnings
+func (c *command) validate(args []string, lint bool) int {
+	name := "validate"
+	if lint {
+		name = "lint"
+	}
+	fs := c.flags(name, "RULES...")
+	var compile compileOptions
+	compile.register(fs)
+	quiet := fs.Bool("q", false, "print nothing, only set the exit status")
+	if status, ok := c.parse(fs, args, 1, -1); !ok {
+		return status
+	}
+
+	opts, err := compile.options()
+	if err != nil {
+		return c.errorf("%v", err)
+	}
+
+	status := exitOK
+	for _, path := range fs.Args() {
+		diagnostics, err := c.validateFile(path, &compile, opts)
+		if err != nil {
+			return c.errorf("%v", err)
+		}
+		for _, diagnostic := range diagnostics {
+			if !*quiet {
+				fmt.Fprintf(c.stdout, "%s: %s\n", path, diagnostic)
+			}
+			if diagnostic.Severity == rule.SeverityError || lint {
+				status = exitFailed
+			}
+		}
+	}
+	return status
+}
+
+// validateFile returns the diagnostics of a rule document, a document that can not be
+// parsed is a single error diagnostic
+func (c *command) validateFile(path string, compile *compileOptions, opts []rule.Option) (rule.Diagnostics, error) {
+	format, err := compile.documentFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ruleSet, err := rule.ParseRuleSet(data, format)
+	if err != nil {
+		return rule.Diagnostics{{Severity: rule.SeverityError, Message: err.Error(), Err: err}}, nil
+	}
+	return rule.Validate(ruleSet, opts...), nil
+}
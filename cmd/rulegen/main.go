@@ -0,0 +1,211 @@
+// Command rulegen generates the RuleField method of rule.FieldAccessor for structs, so
+// rules are evaluated against them without reflection. It is meant for go:generate:
+//
+//	//go:generate go run github.com/nurettintopal/rule/cmd/rulegen -type Order,Customer
+//
+// Fields are named like the rule package names them by reflection, by their rule tag,
+// their json tag or their Go name. Embedded structs must be generated too.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct type names, required")
+	output := flag.String("output", "", "output file name, default <type>_rule.go")
+	dir := flag.String("dir", ".", "directory of the package")
+	flag.Parse()
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	types := strings.Split(*typeNames, ",")
+	if *output == "" {
+		*output = strings.ToLower(types[0]) + "_rule.go"
+	}
+
+	if err := run(*dir, types, filepath.Join(*dir, *output)); err != nil {
+		fmt.Fprintln(os.Stderr, "rulegen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the methods of the types declared in the package of dir into output
+func run(dir string, types []string, output string) error {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != filepath.Base(output)
+	}, 0)
+	if err != nil {
+		return err
+	}
+	if len(packages) != 1 {
+		return fmt.Errorf("expected a single package in %s, found %d", dir, len(packages))
+	}
+
+	for name, pkg := range packages {
+		files := make([]*ast.File, 0, len(pkg.Files))
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+		source, err := generate(name, files, types)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(output, source, 0o644)
+	}
+	return nil
+}
+
+// generate returns the source of the RuleField methods of the types
+func generate(pkg string, files []*ast.File, types []string) ([]byte, error) {
+	structs := map[string]*ast.StructType{}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				if s, ok := spec.Type.(*ast.StructType); ok {
+					structs[spec.Name.Name] = s
+				}
+			}
+			return true
+		})
+	}
+
+	generated := map[string]bool{}
+	for _, name := range types {
+		generated[name] = true
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by rulegen. DO NOT EDIT.\n\npackage %s\n", pkg)
+	for _, name := range types {
+		s, exists := structs[name]
+		if !exists {
+			return nil, fmt.Errorf("struct type %s not found", name)
+		}
+		if err := writeMethod(&buf, name, s, structs, generated); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+// writeMethod writes the RuleField method of a struct
+func writeMethod(buf *bytes.Buffer, name string, s *ast.StructType, structs map[string]*ast.StructType, generated map[string]bool) error {
+	var cases []string
+	var embedded []string
+	fields := map[string]string{}
+	for _, field := range s.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		fieldName, skip := tagName(reflect.StructTag(tag))
+		if skip {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			typeName, local, pointer := embeddedType(field.Type)
+			if fieldName == "" && !local {
+				return fmt.Errorf("%s: embedded field %s of another package needs a rule tag", name, typeName)
+			}
+			if fieldName == "" && structs[typeName] != nil {
+				if !generated[typeName] {
+					return fmt.Errorf("%s: embedded field %s must be generated too", name, typeName)
+				}
+				embedded = append(embedded, writeEmbedded(typeName, pointer))
+				continue
+			}
+			if fieldName == "" {
+				fieldName = typeName
+			}
+			if ast.IsExported(typeName) {
+				fields[fieldName] = typeName
+			}
+			continue
+		}
+
+		for _, ident := range field.Names {
+			if !ast.IsExported(ident.Name) {
+				continue
+			}
+			if fieldName == "" {
+				fields[ident.Name] = ident.Name
+			} else {
+				fields[fieldName] = ident.Name
+			}
+		}
+	}
+
+	for ruleName := range fields {
+		cases = append(cases, ruleName)
+	}
+	sort.Strings(cases)
+
+	fmt.Fprintf(buf, "\n// RuleField returns the field of the name rules use, it implements rule.FieldAccessor\n")
+	fmt.Fprintf(buf, "func (x %s) RuleField(name string) (interface{}, bool) {\n", name)
+	if len(cases) > 0 {
+		buf.WriteString("switch name {\n")
+		for _, ruleName := range cases {
+			fmt.Fprintf(buf, "case %q:\nreturn x.%s, true\n", ruleName, fields[ruleName])
+		}
+		buf.WriteString("}\n")
+	}
+	for _, e := range embedded {
+		buf.WriteString(e)
+	}
+	buf.WriteString("return nil, false\n}\n")
+	return nil
+}
+
+// writeEmbedded returns the lookup of a field in an embedded struct
+func writeEmbedded(typeName string, pointer bool) string {
+	if pointer {
+		return fmt.Sprintf("if x.%[1]s != nil {\nif value, exists := x.%[1]s.RuleField(name); exists {\nreturn value, true\n}\n}\n", typeName)
+	}
+	return fmt.Sprintf("if value, exists := x.%s.RuleField(name); exists {\nreturn value, true\n}\n", typeName)
+}
+
+// embeddedType returns the type name of an embedded field and whether it is declared in
+// the package
+func embeddedType(expr ast.Expr) (name string, local, pointer bool) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+		pointer = true
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name, true, pointer
+	case *ast.SelectorExpr:
+		return t.Sel.Name, false, pointer
+	}
+	return "", false, pointer
+}
+
+// tagName reads the name of a field from its rule or json tag, like the rule package does
+func tagName(tag reflect.StructTag) (string, bool) {
+	if name, exists := tag.Lookup("rule"); exists {
+		name, _, _ = strings.Cut(name, ",")
+		return name, name == "-"
+	}
+	name, options, _ := strings.Cut(tag.Get("json"), ",")
+	if name == "-" && options == "" {
+		return "", true
+	}
+	return name, false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSource = `package shop
+
+type Audit struct {
+	CreatedBy string ` + "`json:\"createdBy\"`" + `
+}
+
+type Customer struct {
+	*Audit
+	Name    string  ` + "`json:\"name\" rule:\"customer\"`" + `
+	Country *string ` + "`json:\"country,omitempty\"`" + `
+	Tags    []string
+	Secret  string ` + "`rule:\"-\"`" + `
+	Ignored string ` + "`json:\"-\"`" + `
+	note    string
+}
+`
+
+func TestGenerate(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "shop.go", testSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := generate("shop", []*ast.File{file}, []string{"Customer", "Audit"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "customer_rule.go", source, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, source)
+	}
+
+	code := string(source)
+	for _, expected := range []string{
+		"// Code generated by rulegen. DO NOT EDIT.",
+		"func (x Customer) RuleField(name string) (interface{}, bool) {",
+		"case \"customer\":\n\t\treturn x.Name, true",
+		"case \"country\":\n\t\treturn x.Country, true",
+		"case \"Tags\":\n\t\treturn x.Tags, true",
+		"if x.Audit != nil {",
+		"func (x Audit) RuleField(name string) (interface{}, bool) {",
+		"case \"createdBy\":\n\t\treturn x.CreatedBy, true",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("expected the generated source to contain %q\n%s", expected, code)
+		}
+	}
+	for _, unexpected := range []string{"Secret", "Ignored", "note"} {
+		if strings.Contains(code, unexpected) {
+			t.Errorf("expected the generated source not to contain %q\n%s", unexpected, code)
+		}
+	}
+
+	if _, err := generate("shop", []*ast.File{file}, []string{"Customer"}); err == nil {
+		t.Errorf("expected an error for an embedded struct that is not generated")
+	}
+	if _, err := generate("shop", []*ast.File{file}, []string{"Order"}); err == nil {
+		t.Errorf("expected an error for an unknown type")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shop.go"), []byte(testSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "customer_rule.go")
+	if err := run(dir, []string{"Customer", "Audit"}, output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the output of an earlier run is not read as part of the package
+	if err := run(dir, []string{"Customer", "Audit"}, output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("expected the output file to be written: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Command ruleserver serves the rule documents of a directory over HTTP with the endpoints
+// of package rulehttp. Every JSON, YAML, TOML or expression file of the directory is a rule
+// set named by the file name without its extension, test files are skipped.
+//
+//	ruleserver -dir rules -addr :8080 -watch 5s
+//
+// A document that does not compile stops the server from starting. Once it runs, the
+// directory is polled for changed documents every -watch interval, a document that does not
+// compile is logged and the last version that did keeps being served. Rule sets are
+// evaluated by the priority of their documents.
+// It stops accepting requests on SIGINT or SIGTERM and waits for the requests in flight.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nurettintopal/rule"
+	"github.com/nurettintopal/rule/rulehttp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dir := flag.String("dir", "rules", "directory of the rule documents")
+	strategy := flag.String("strategy", "all", "matches returned by /evaluate: all, first or score")
+	maxBody := flag.Int64("max-body", rulehttp.DefaultMaxBodyBytes, "largest request body in bytes")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "time the requests in flight are given on shutdown")
+	watch := flag.Duration("watch", 2*time.Second, "interval the directory is polled for changes at, 0 to load it once")
+	flag.Parse()
+
+	s, err := parseStrategy(*strategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	engine := rule.NewEngine(s)
+	repository, err := rule.NewRepository(*dir, engine)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ids := engine.IDs()
+	log.Printf("loaded %d rule sets from %s: %s", len(ids), *dir, strings.Join(ids, ", "))
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", listener.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *watch > 0 {
+		repository.Subscribe(func(event rule.ReloadEvent) {
+			logReload(log.Default(), event)
+		})
+		go repository.Watch(ctx, *watch)
+	}
+	handler := rulehttp.NewHandler(engine, rulehttp.WithMaxBodyBytes(*maxBody))
+	if err := serve(ctx, listener, handler, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+	log.Print("stopped")
+}
+
+// parseStrategy returns the engine strategy of the flag
+func parseStrategy(name string) (rule.Strategy, error) {
+	switch name {
+	case "all":
+		return rule.AllMatches, nil
+	case "first":
+		return rule.FirstMatch, nil
+	case "score":
+		return rule.HighestScore, nil
+	}
+	return 0, fmt.Errorf("unknown strategy %q", name)
+}
+
+// logReload logs the changes and errors of a reload
+func logReload(logger *log.Logger, event rule.ReloadEvent) {
+	for _, change := range []struct {
+		verb string
+		ids  []string
+	}{{"added", event.Added}, {"updated", event.Updated}, {"removed", event.Removed}} {
+		if len(change.ids) > 0 {
+			logger.Printf("%s rule sets: %s", change.verb, strings.Join(change.ids, ", "))
+		}
+	}
+	for _, err := range event.Errors {
+		logger.Printf("reload: %v", err)
+	}
+}
+
+// serve serves the handler until the context is done, then shuts the server down giving
+// the requests in flight the timeout to finish
+func serve(ctx context.Context, listener net.Listener, handler http.Handler, timeout time.Duration) error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
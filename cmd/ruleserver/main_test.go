@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nurettintopal/rule"
+	"github.com/nurettintopal/rule/rulehttp"
+)
+
+func TestLogReload(t *testing.T) {
+	var logs strings.Builder
+	logger := log.New(&logs, "", 0)
+	logReload(logger, rule.ReloadEvent{
+		Added:   []string{"gold", "large"},
+		Removed: []string{"small"},
+		Errors:  []error{&rule.RuleSetError{ID: "broken", Err: errors.New("rules/broken.json: invalid rules")}},
+	})
+
+	expected := "added rule sets: gold, large\nremoved rule sets: small\nreload: rule set \"broken\": rules/broken.json: invalid rules\n"
+	if logs.String() != expected {
+		t.Errorf("logs = %q; expected %q", logs.String(), expected)
+	}
+}
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve(ctx, listener, rulehttp.NewHandler(rule.NewEngine(rule.AllMatches)), time.Second)
+	}()
+
+	response, err := http.Get("http://" + listener.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("status = %d; expected the server to be healthy", response.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to shut down")
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	if s, err := parseStrategy("score"); err != nil || s != rule.HighestScore {
+		t.Errorf("parseStrategy(score) = %v, %v", s, err)
+	}
+	if _, err := parseStrategy("best"); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
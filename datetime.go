@@ -0,0 +1,530 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BeforeOperator checks if the fieldValue time is before the ruleValue time. ruleValue is a
+// time, "now", or a duration such as "30d" meaning that long ago.
+type BeforeOperator struct {
+	// Now returns the evaluation time, time.Now is used when it is nil
+	Now func() time.Time
+}
+
+func (o BeforeOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o BeforeOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	point, err := parsePoint(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return field.Before(point.at(now(o.Now))), nil
+}
+
+// AfterOperator checks if the fieldValue time is after the ruleValue time. ruleValue is a
+// time, "now", or a duration such as "30d" meaning that long ago.
+type AfterOperator struct {
+	// Now returns the evaluation time, time.Now is used when it is nil
+	Now func() time.Time
+}
+
+func (o AfterOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o AfterOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	point, err := parsePoint(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return field.After(point.at(now(o.Now))), nil
+}
+
+// BetweenOperator checks if the fieldValue time is between the two times of the ruleValue
+// array, both ends included. Each end is a time, "now", or a duration meaning that long ago.
+type BetweenOperator struct {
+	// Now returns the evaluation time, time.Now is used when it is nil
+	Now func() time.Time
+}
+
+func (o BetweenOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o BetweenOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	from, to, err := parseRange(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return inRange(field, from, to, now(o.Now)), nil
+}
+
+// WithinLastOperator checks if the fieldValue time is within the ruleValue duration before now
+type WithinLastOperator struct {
+	// Now returns the evaluation time, time.Now is used when it is nil
+	Now func() time.Time
+}
+
+func (o WithinLastOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o WithinLastOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	p, err := parsePeriod(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return withinLast(field, p, now(o.Now)), nil
+}
+
+// OlderThanOperator checks if the fieldValue time is more than the ruleValue duration before now
+type OlderThanOperator struct {
+	// Now returns the evaluation time, time.Now is used when it is nil
+	Now func() time.Time
+}
+
+func (o OlderThanOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o OlderThanOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	p, err := parsePeriod(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return field.Before(p.ago(now(o.Now))), nil
+}
+
+// DayOfWeekInOperator checks if the day of the fieldValue time is in the ruleValue array of
+// day names ("Monday", "mon") or numbers (0 is Sunday). ruleValue can also be an object
+// {"days": [...], "timezone": "Europe/Istanbul"} to pick the day in another time zone.
+type DayOfWeekInOperator struct{}
+
+func (o DayOfWeekInOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o DayOfWeekInOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	days, loc, err := parseDays(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return inDays(field, days, loc), nil
+}
+
+// TimeOfDayBetweenOperator checks if the clock time of the fieldValue time is between two
+// "HH:MM" or "HH:MM:SS" times, both ends included. ruleValue is ["09:00", "17:00"],
+// ["09:00", "17:00", "Europe/Istanbul"] or {"from": ..., "to": ..., "timezone": ...}.
+// A range whose end is before its start wraps around midnight.
+type TimeOfDayBetweenOperator struct{}
+
+func (o TimeOfDayBetweenOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o TimeOfDayBetweenOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	from, to, loc, err := parseClockRange(ruleValue)
+	if err != nil {
+		return false, err
+	}
+	return inClockRange(field, from, to, loc), nil
+}
+
+// compiledTimeOperator is a time operator whose rule value has been parsed once, check
+// gets the field time
+type compiledTimeOperator struct {
+	check func(field time.Time) bool
+}
+
+func (o compiledTimeOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o compiledTimeOperator) Check(fieldValue, _ interface{}) (bool, error) {
+	field, err := fieldTime(fieldValue)
+	if err != nil {
+		return false, err
+	}
+	return o.check(field), nil
+}
+
+// inRange reports whether t is between the ends of a time range, the ends are put in order
+func inRange(t time.Time, from, to timePoint, current time.Time) bool {
+	start, end := from.at(current), to.at(current)
+	if start.After(end) {
+		start, end = end, start
+	}
+	return !t.Before(start) && !t.After(end)
+}
+
+// withinLast reports whether t is in the period before current
+func withinLast(t time.Time, p period, current time.Time) bool {
+	return !t.Before(p.ago(current)) && !t.After(current)
+}
+
+// inDays reports whether the day of t, in loc when it is set, is one of days
+func inDays(t time.Time, days []time.Weekday, loc *time.Location) bool {
+	if loc != nil {
+		t = t.In(loc)
+	}
+	for _, day := range days {
+		if t.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
+// inClockRange reports whether the clock time of t, in loc when it is set, is in a range of
+// offsets from midnight, a range whose end is before its start wraps around midnight
+func inClockRange(t time.Time, from, to time.Duration, loc *time.Location) bool {
+	if loc != nil {
+		t = t.In(loc)
+	}
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if from <= to {
+		return clock >= from && clock <= to
+	}
+	return clock >= from || clock <= to
+}
+
+func now(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock()
+}
+
+// fieldTime converts a field value to a time
+func fieldTime(value interface{}) (time.Time, error) {
+	t, ok := parseTime(value)
+	if !ok {
+		return time.Time{}, fieldMismatch("time", value)
+	}
+	return t, nil
+}
+
+// parseTime accepts time.Time values, RFC 3339 strings, dates such as "2024-05-01" and
+// Unix timestamps in seconds given as numbers or numeric strings
+func parseTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+		return time.Time{}, false
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	if n, ok := toNumber(value, true); ok {
+		if n.isInt {
+			return time.Unix(n.i, 0).UTC(), true
+		}
+		seconds := int64(n.f)
+		return time.Unix(seconds, int64((n.f-float64(seconds))*1e9)).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// timePoint is a parsed time rule value, either a fixed time or a period before now
+type timePoint struct {
+	fixed    time.Time
+	relative bool
+	period   period
+}
+
+// at returns the time of the point when it is current
+func (p timePoint) at(current time.Time) time.Time {
+	if p.relative {
+		return p.period.ago(current)
+	}
+	return p.fixed
+}
+
+// parsePoint converts a rule value to a time point, "now" is a period of zero
+func parsePoint(value interface{}) (timePoint, error) {
+	if value == "now" {
+		return timePoint{relative: true}, nil
+	}
+	if t, ok := parseTime(value); ok {
+		return timePoint{fixed: t}, nil
+	}
+	if s, ok := value.(string); ok {
+		if p, err := parsePeriod(s); err == nil {
+			return timePoint{relative: true, period: p}, nil
+		}
+	}
+	return timePoint{}, valueMismatch("time or duration", value)
+}
+
+// parseRange converts a two element rule value to the ends of a time range
+func parseRange(value interface{}) (timePoint, timePoint, error) {
+	if times, ok := value.([]string); ok {
+		value = toInterfaces(times)
+	}
+	list, ok := value.([]interface{})
+	if !ok || len(list) != 2 {
+		return timePoint{}, timePoint{}, valueMismatch("array of two times", value)
+	}
+	from, err := parsePoint(list[0])
+	if err != nil {
+		return timePoint{}, timePoint{}, err
+	}
+	to, err := parsePoint(list[1])
+	if err != nil {
+		return timePoint{}, timePoint{}, err
+	}
+	return from, to, nil
+}
+
+// period is a duration whose years, months and days follow the calendar
+type period struct {
+	years, months, days int
+	duration            time.Duration
+}
+
+// ago returns the time the period before t
+func (p period) ago(t time.Time) time.Time {
+	return t.AddDate(-p.years, -p.months, -p.days).Add(-p.duration)
+}
+
+var (
+	isoPeriodPattern  = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	unitPeriodPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+)
+
+// parsePeriod accepts ISO 8601 durations such as "P1M" or "P1DT12H", Go durations extended
+// with days and weeks such as "30d" or "1w2d12h", and numbers of seconds
+func parsePeriod(value interface{}) (period, error) {
+	s, ok := value.(string)
+	if !ok {
+		if n, ok := toNumber(value, false); ok {
+			return period{duration: time.Duration(n.float() * float64(time.Second))}, nil
+		}
+		return period{}, valueMismatch("duration", value)
+	}
+
+	if strings.HasPrefix(s, "P") {
+		match := isoPeriodPattern.FindStringSubmatch(s)
+		if match == nil || s == "P" || strings.HasSuffix(s, "T") {
+			return period{}, invalidDuration(s)
+		}
+		atoi := func(s string) int {
+			n, _ := strconv.Atoi(s)
+			return n
+		}
+		seconds, _ := strconv.ParseFloat(match[7], 64)
+		return period{
+			years:    atoi(match[1]),
+			months:   atoi(match[2]),
+			days:     atoi(match[3])*7 + atoi(match[4]),
+			duration: time.Duration(atoi(match[5]))*time.Hour + time.Duration(atoi(match[6]))*time.Minute + time.Duration(seconds*float64(time.Second)),
+		}, nil
+	}
+
+	if s == "" {
+		return period{}, invalidDuration(s)
+	}
+	var p period
+	rest := s
+	for rest != "" {
+		match := unitPeriodPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return period{}, invalidDuration(s)
+		}
+		rest = rest[len(match[0]):]
+
+		switch match[2] {
+		case "d", "w":
+			days, err := strconv.Atoi(match[1])
+			if err != nil {
+				return period{}, invalidDuration(s)
+			}
+			if match[2] == "w" {
+				days *= 7
+			}
+			p.days += days
+		default:
+			d, err := time.ParseDuration(match[0])
+			if err != nil {
+				return period{}, invalidDuration(s)
+			}
+			p.duration += d
+		}
+	}
+	return p, nil
+}
+
+func invalidDuration(s string) error {
+	return valueMismatch("duration", s)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseDays converts the rule value of dayOfWeekIn to week days and an optional time zone
+func parseDays(value interface{}) ([]time.Weekday, *time.Location, error) {
+	var loc *time.Location
+	if object, ok := value.(map[string]interface{}); ok {
+		var err error
+		if loc, err = parseLocation(object["timezone"]); err != nil {
+			return nil, nil, err
+		}
+		value = object["days"]
+	}
+
+	if names, ok := value.([]string); ok {
+		value = toInterfaces(names)
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, nil, valueMismatch("array of days", value)
+	}
+
+	days := make([]time.Weekday, 0, len(list))
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			day, exists := weekdays[strings.ToLower(name)]
+			if !exists {
+				return nil, nil, valueMismatch("day of week", item)
+			}
+			days = append(days, day)
+			continue
+		}
+		n, ok := toNumber(item, false)
+		if !ok || !n.isInt || n.i < 0 || n.i > 6 {
+			return nil, nil, valueMismatch("day of week", item)
+		}
+		days = append(days, time.Weekday(n.i))
+	}
+	return days, loc, nil
+}
+
+// parseClockRange converts the rule value of timeOfDayBetween to offsets from midnight
+func parseClockRange(value interface{}) (time.Duration, time.Duration, *time.Location, error) {
+	var from, to, zone interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		from, to, zone = v["from"], v["to"], v["timezone"]
+	case []interface{}:
+		if len(v) < 2 || len(v) > 3 {
+			return 0, 0, nil, valueMismatch("array of two times of day", value)
+		}
+		from, to = v[0], v[1]
+		if len(v) == 3 {
+			zone = v[2]
+		}
+	case []string:
+		return parseClockRange(toInterfaces(v))
+	default:
+		return 0, 0, nil, valueMismatch("array of two times of day", value)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	loc, err := parseLocation(zone)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return start, end, loc, nil
+}
+
+// parseClock converts "HH:MM" or "HH:MM:SS" to the offset from midnight
+func parseClock(value interface{}) (time.Duration, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, valueMismatch("time of day", value)
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, valueMismatch("time of day", value)
+}
+
+// parseLocation loads an IANA time zone, a missing zone leaves times in their own zone
+func parseLocation(value interface{}) (*time.Location, error) {
+	if value == nil {
+		return nil, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return nil, valueMismatch("time zone", value)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+func toInterfaces(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return list
+}
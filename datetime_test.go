@@ -0,0 +1,161 @@
+package rule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected period
+	}{
+		{"30d", period{days: 30}},
+		{"1w2d12h30m", period{days: 9, duration: 12*time.Hour + 30*time.Minute}},
+		{"90m", period{duration: 90 * time.Minute}},
+		{"P1M", period{months: 1}},
+		{"P1Y2M3W4DT5H6M7.5S", period{years: 1, months: 2, days: 25, duration: 5*time.Hour + 6*time.Minute + 7500*time.Millisecond}},
+		{3600.0, period{duration: time.Hour}},
+	}
+
+	for _, test := range tests {
+		p, err := parsePeriod(test.value)
+		if err != nil {
+			t.Errorf("parsePeriod(%v) unexpected error: %v", test.value, err)
+		}
+		if p != test.expected {
+			t.Errorf("parsePeriod(%v) = %+v; expected %+v", test.value, p, test.expected)
+		}
+	}
+
+	for _, value := range []interface{}{"", "P", "PT", "30", "1.5d", "30 days", true} {
+		if _, err := parsePeriod(value); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("parsePeriod(%v) error = %v; expected %v", value, err, ErrTypeMismatch)
+		}
+	}
+}
+
+func TestDateTimeOperators(t *testing.T) {
+	// Wednesday
+	current := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return current }
+
+	tests := []struct {
+		operator   Operator
+		fieldValue interface{}
+		ruleValue  interface{}
+		expected   bool
+	}{
+		{BeforeOperator{Now: clock}, "2024-05-01T10:00:00Z", "2024-05-02", true},
+		{BeforeOperator{Now: clock}, "2024-05-01T10:00:00Z", "30d", false},
+		{BeforeOperator{Now: clock}, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), "P1M", true},
+		{AfterOperator{Now: clock}, 1715778000.0, "now", true},
+		{AfterOperator{Now: clock}, "1715774400", "2024-05-15T11:00:00+00:00", true},
+		{BetweenOperator{Now: clock}, "2024-05-10", []interface{}{"7d", "now"}, true},
+		{BetweenOperator{Now: clock}, "2024-05-10", []interface{}{"2024-05-11", "2024-05-12"}, false},
+		{WithinLastOperator{Now: clock}, "2024-04-20T00:00:00Z", "30d", true},
+		{WithinLastOperator{Now: clock}, "2024-04-20T00:00:00Z", "P7D", false},
+		{WithinLastOperator{Now: clock}, "2024-06-01T00:00:00Z", "30d", false},
+		{OlderThanOperator{Now: clock}, "2024-04-01T00:00:00Z", "30d", true},
+		{OlderThanOperator{Now: clock}, "2024-04-20T00:00:00Z", "P1M", false},
+		{DayOfWeekInOperator{}, current, []interface{}{"Monday", "wed"}, true},
+		{DayOfWeekInOperator{}, current, []interface{}{0.0, 6.0}, false},
+		{DayOfWeekInOperator{}, "2024-05-15T22:00:00Z", map[string]interface{}{"days": []interface{}{"thursday"}, "timezone": "Europe/Istanbul"}, true},
+		{TimeOfDayBetweenOperator{}, "2024-05-15T07:30:00Z", []interface{}{"09:00", "17:00", "Europe/Istanbul"}, true},
+		{TimeOfDayBetweenOperator{}, "2024-05-15T07:30:00Z", []interface{}{"09:00", "17:00"}, false},
+		{TimeOfDayBetweenOperator{}, "2024-05-15T23:30:00Z", map[string]interface{}{"from": "22:00", "to": "06:00"}, true},
+	}
+
+	for _, test := range tests {
+		if test.operator.Apply(test.fieldValue, test.ruleValue) != test.expected {
+			t.Errorf("%T.Apply(%v, %v) = %v; expected %v", test.operator, test.fieldValue, test.ruleValue, !test.expected, test.expected)
+		}
+	}
+
+	if _, err := (BeforeOperator{}).Check("yesterday", "now"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("error = %v; expected %v", err, ErrTypeMismatch)
+	}
+}
+
+func TestBuildDateTimeOperators(t *testing.T) {
+	// Wednesday
+	current := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return current }
+
+	tests := []struct {
+		operator   string
+		fieldValue interface{}
+		ruleValue  interface{}
+		expected   bool
+	}{
+		{"before", "2024-05-01T10:00:00Z", "30d", false},
+		{"after", 1715778000.0, "now", true},
+		{"between", "2024-05-10", []interface{}{"now", "7d"}, true},
+		// rule values built in Go can be string slices
+		{"between", "2024-05-10", []string{"2024-05-01", "2024-05-12"}, true},
+		{"dayOfWeekIn", "2024-05-15T12:00:00Z", []string{"wednesday"}, true},
+		{"timeOfDayBetween", "2024-05-15T12:00:00Z", []string{"09:00", "17:00"}, true},
+		{"withinLast", "2024-04-20T00:00:00Z", "30d", true},
+		{"olderThan", "2024-04-20T00:00:00Z", "P1M", false},
+		{"dayOfWeekIn", "2024-05-15T22:00:00Z", map[string]interface{}{"days": []interface{}{"thursday"}, "timezone": "Europe/Istanbul"}, true},
+		{"timeOfDayBetween", "2024-05-15T23:30:00Z", map[string]interface{}{"from": "22:00", "to": "06:00"}, true},
+	}
+
+	for _, test := range tests {
+		spec, _ := builtinRegistry.Lookup(test.operator)
+		operator, err := spec.build(OperatorConfig{Clock: clock}, test.ruleValue)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.operator, err)
+		}
+		// the built operator holds the parsed rule value, it does not read it again
+		result, err := operator.(CheckedOperator).Check(test.fieldValue, nil)
+		if err != nil || result != test.expected {
+			t.Errorf("%s.Check(%v) = %v, %v; expected %v", test.operator, test.fieldValue, result, err, test.expected)
+		}
+	}
+}
+
+func TestEvaluateWithDateTimeOperators(t *testing.T) {
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"createdAt",
+				   "operator":"olderThan",
+				   "value":"30d"
+				},
+				{
+				   "field":"orderedAt",
+				   "operator":"timeOfDayBetween",
+				   "value":["09:00", "17:00", "Europe/Istanbul"]
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	clock := func() time.Time { return time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC) }
+	program, err := Compile(rules, WithClock(clock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := program.Eval(`{"createdAt":"2024-03-01T00:00:00Z","orderedAt":"2024-05-15T10:00:00+03:00"}`)
+	if err != nil || !result {
+		t.Errorf("Eval = %v, %v; expected true", result, err)
+	}
+
+	result, err = program.Eval(`{"createdAt":"2024-05-01T00:00:00Z","orderedAt":"2024-05-15T10:00:00+03:00"}`)
+	if err != nil || result {
+		t.Errorf("Eval = %v, %v; expected false", result, err)
+	}
+
+	for _, value := range []string{`"30 days"`, `["09:00"]`, `["09:00", "17:00", "Mars/Olympus"]`} {
+		rules := `{"conditions":[{"all":[{"field":"createdAt","operator":"timeOfDayBetween","value":` + value + `}]}]}`
+		if _, err := Compile(rules); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("Compile(%s) error = %v; expected %v", value, err, ErrInvalidRules)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package rule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Strategy decides which of the matched rule sets an Engine returns
+type Strategy int
+
+const (
+	// AllMatches returns every matched rule set, by priority
+	AllMatches Strategy = iota
+	// FirstMatch returns the matched rule set with the highest priority, rule sets with
+	// a lower priority are not evaluated
+	FirstMatch
+	// HighestScore returns the matched rule set with the highest score, ties are broken by
+	// priority. The score of a rule set in scoring mode is the score computed for the input.
+	HighestScore
+)
+
+// Match is a rule set that passed in an Engine
+type Match struct {
+	ID       string   `json:"id"`
+	Priority int      `json:"priority"`
+	Score    float64  `json:"score"`
+	Version  string   `json:"version,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+}
+
+// RuleSetError is returned by an Engine for a rule set that could not be evaluated
+type RuleSetError struct {
+	ID  string
+	Err error
+}
+
+func (e *RuleSetError) Error() string {
+	return fmt.Sprintf("rule set %q: %v", e.ID, e.Err)
+}
+
+func (e *RuleSetError) Unwrap() error {
+	return e.Err
+}
+
+// Engine holds many named, prioritised rule sets and evaluates them against one input.
+// It is safe for concurrent use.
+type Engine struct {
+	strategy Strategy
+	opts     []Option
+
+	mu      sync.RWMutex
+	entries []*engineEntry
+	added   int
+}
+
+type engineEntry struct {
+	id       string
+	priority int
+	program  *Program
+	// order keeps rule sets with the same priority in the order they were added
+	order int
+}
+
+// NewEngine returns an empty engine, the options are used to compile the rule sets added to it
+func NewEngine(strategy Strategy, opts ...Option) *Engine {
+	return &Engine{strategy: strategy, opts: opts}
+}
+
+// Add compiles the rules and adds them under the id, replacing the rule set with the same id
+func (e *Engine) Add(id string, priority int, rules string) error {
+	program, err := Compile(rules, e.opts...)
+	if err != nil {
+		return &RuleSetError{ID: id, Err: err}
+	}
+	e.AddProgram(id, priority, program)
+	return nil
+}
+
+// AddRuleSet compiles the rule set and adds it under the id, replacing the rule set with the same id
+func (e *Engine) AddRuleSet(id string, priority int, ruleSet RuleSet) error {
+	program, err := CompileRuleSet(ruleSet, e.opts...)
+	if err != nil {
+		return &RuleSetError{ID: id, Err: err}
+	}
+	e.AddProgram(id, priority, program)
+	return nil
+}
+
+// AddProgram adds a compiled rule set under the id, replacing the rule set with the same id
+func (e *Engine) AddProgram(id string, priority int, program *Program) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.removeLocked(id)
+	e.added++
+	// entries are never changed in place, so Run can keep using the slice it read
+	entries := make([]*engineEntry, 0, len(e.entries)+1)
+	entries = append(entries, e.entries...)
+	entries = append(entries, &engineEntry{id: id, priority: priority, program: program, order: e.added})
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].priority != entries[j].priority {
+			return entries[i].priority > entries[j].priority
+		}
+		return entries[i].order < entries[j].order
+	})
+	e.entries = entries
+}
+
+// Replace replaces every rule set of the engine at once, runs in flight keep evaluating the
+// rule sets they started with. An entry with the id of an earlier entry is ignored.
+func (e *Engine) Replace(entries []EngineEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	replaced := make([]*engineEntry, 0, len(entries))
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			continue
+		}
+		seen[entry.ID] = true
+		e.added++
+		replaced = append(replaced, &engineEntry{id: entry.ID, priority: entry.Priority, program: entry.Program, order: e.added})
+	}
+	sort.SliceStable(replaced, func(i, j int) bool {
+		return replaced[i].priority > replaced[j].priority
+	})
+	e.entries = replaced
+}
+
+// Remove removes the rule set with the id
+func (e *Engine) Remove(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeLocked(id)
+}
+
+func (e *Engine) removeLocked(id string) {
+	for i, entry := range e.entries {
+		if entry.id == id {
+			e.entries = append(e.entries[:i:i], e.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// IDs returns the ids of the rule sets in the order they are evaluated
+func (e *Engine) IDs() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ids := make([]string, 0, len(e.entries))
+	for _, entry := range e.entries {
+		ids = append(ids, entry.id)
+	}
+	return ids
+}
+
+// EngineEntry is a rule set added to an Engine
+type EngineEntry struct {
+	ID       string
+	Priority int
+	Program  *Program
+}
+
+// Entries returns the rule sets in the order they are evaluated
+func (e *Engine) Entries() []EngineEntry {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	entries := make([]EngineEntry, 0, len(e.entries))
+	for _, entry := range e.entries {
+		entries = append(entries, EngineEntry{ID: entry.id, Priority: entry.priority, Program: entry.program})
+	}
+	return entries
+}
+
+// Entry returns the rule set with the id
+func (e *Engine) Entry(id string) (EngineEntry, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, entry := range e.entries {
+		if entry.id == id {
+			return EngineEntry{ID: entry.id, Priority: entry.priority, Program: entry.program}, true
+		}
+	}
+	return EngineEntry{}, false
+}
+
+// Run evaluates the rule sets by priority and returns the matches selected by the strategy.
+// Rule sets outside their effective window are skipped.
+// A rule set that fails with an error does not match, the errors are returned joined as
+// RuleSetErrors next to the matches of the other rule sets.
+func (e *Engine) Run(input interface{}) ([]Match, error) {
+	return e.RunContext(context.Background(), input)
+}
+
+// RunContext runs the rule sets like Run does. Once the context is cancelled or its deadline
+// is exceeded, the remaining rule sets are not evaluated and only the error of the context
+// is returned.
+func (e *Engine) RunContext(ctx context.Context, input interface{}) ([]Match, error) {
+	matches, _, err := e.run(ctx, input, false)
+	return matches, err
+}
+
+// RunExplain runs the rule sets like Run does and returns the traces of the rule sets it
+// evaluated by id, taken from the same evaluations as the matches
+func (e *Engine) RunExplain(input interface{}) ([]Match, map[string]*Trace, error) {
+	return e.RunExplainContext(context.Background(), input)
+}
+
+// RunExplainContext runs the rule sets like RunExplain does, stopping like RunContext does
+func (e *Engine) RunExplainContext(ctx context.Context, input interface{}) ([]Match, map[string]*Trace, error) {
+	return e.run(ctx, input, true)
+}
+
+// run evaluates the rule sets, collecting their traces when explain is set
+func (e *Engine) run(ctx context.Context, input interface{}, explain bool) ([]Match, map[string]*Trace, error) {
+	obj, err := parseInput(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e.mu.RLock()
+	entries := e.entries
+	e.mu.RUnlock()
+
+	var matches []Match
+	var errs []error
+	var traces map[string]*Trace
+	if explain {
+		traces = map[string]*Trace{}
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		var result Result
+		var err error
+		if explain {
+			// the trace of a rule set that fails with an error shows the rule that failed
+			result, traces[entry.id], err = entry.program.RunExplainContext(ctx, obj)
+		} else {
+			result, err = entry.program.RunContext(ctx, obj)
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			errs = append(errs, &RuleSetError{ID: entry.id, Err: err})
+			continue
+		}
+		if !result.Passed {
+			continue
+		}
+
+		score := entry.program.ruleSet.Score
+		if entry.program.ruleSet.Scoring != nil {
+			score = result.Score
+		}
+		matches = append(matches, Match{
+			ID:       entry.id,
+			Priority: entry.priority,
+			Score:    score,
+			Version:  entry.program.ruleSet.Version,
+			Actions:  result.Actions,
+		})
+		if e.strategy == FirstMatch {
+			break
+		}
+	}
+
+	if e.strategy == HighestScore && len(matches) > 1 {
+		best := matches[0]
+		for _, match := range matches[1:] {
+			if match.Score > best.Score {
+				best = match
+			}
+		}
+		matches = []Match{best}
+	}
+	return matches, traces, errors.Join(errs...)
+}
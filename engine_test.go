@@ -0,0 +1,186 @@
+package rule
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func newTestEngine(t *testing.T, strategy Strategy) *Engine {
+	engine := NewEngine(strategy)
+	ruleSets := []struct {
+		id       string
+		priority int
+		rules    string
+	}{
+		{"standard", 1, `{"conditions":[{"all":[{"field":"total","operator":"greaterThan","value":0}]}],"score":1,"event":{"type":"fee","params":{"percent":3}}}`},
+		{"gold", 10, `{"conditions":[{"all":[{"field":"tier","operator":"equals","value":"gold"}]}],"score":5,"event":{"type":"fee","params":{"percent":1}}}`},
+		{"large", 5, `{"conditions":[{"all":[{"field":"total","operator":"greaterThan","value":1000}]}],"score":8,"event":{"type":"fee","params":{"percent":2}}}`},
+		{"country", 5, `{"conditions":[{"all":[{"field":"country","operator":"equals","value":"Turkey"}]}]}`},
+	}
+	for _, ruleSet := range ruleSets {
+		if err := engine.Add(ruleSet.id, ruleSet.priority, ruleSet.rules); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return engine
+}
+
+func matchIDs(matches []Match) []string {
+	var ids []string
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+	return ids
+}
+
+func TestEngineRun(t *testing.T) {
+	input := `{"total":2000,"tier":"gold","country":"Turkey"}`
+
+	tests := []struct {
+		strategy Strategy
+		expected []string
+	}{
+		{AllMatches, []string{"gold", "large", "country", "standard"}},
+		{FirstMatch, []string{"gold"}},
+		{HighestScore, []string{"large"}},
+	}
+
+	for _, test := range tests {
+		engine := newTestEngine(t, test.strategy)
+		matches, err := engine.Run(input)
+		if err != nil {
+			t.Errorf("strategy %d: unexpected error: %v", test.strategy, err)
+		}
+		if ids := matchIDs(matches); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("strategy %d: matches = %v; expected %v", test.strategy, ids, test.expected)
+		}
+	}
+
+	engine := newTestEngine(t, FirstMatch)
+	matches, _ := engine.Run(`{"total":2000,"tier":"silver","country":"Turkey"}`)
+	expected := []Match{{ID: "large", Priority: 5, Score: 8, Actions: []Action{{Type: "fee", Params: map[string]interface{}{"percent": 2.0}}}}}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("matches = %+v; expected %+v", matches, expected)
+	}
+}
+
+func TestEngineRunWithErrors(t *testing.T) {
+	engine := newTestEngine(t, AllMatches)
+
+	matches, err := engine.Run(`{"total":10,"tier":"gold"}`)
+	if ids := matchIDs(matches); !reflect.DeepEqual(ids, []string{"gold", "standard"}) {
+		t.Errorf("matches = %v; expected [gold standard]", ids)
+	}
+	var ruleSetErr *RuleSetError
+	if !errors.As(err, &ruleSetErr) || ruleSetErr.ID != "country" || !errors.Is(err, ErrMissingField) {
+		t.Errorf("error = %v; expected missing field in rule set country", err)
+	}
+
+	if err := engine.Add("broken", 1, `{"conditions":[{"all":[{"field":"total","operator":"greaterthan","value":0}]}]}`); !errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("error = %v; expected %v", err, ErrUnknownOperator)
+	}
+}
+
+func TestEngineRunExplain(t *testing.T) {
+	engine := newTestEngine(t, FirstMatch)
+
+	matches, traces, err := engine.RunExplain(`{"total":2000,"tier":"silver"}`)
+	if err != nil || !reflect.DeepEqual(matchIDs(matches), []string{"large"}) {
+		t.Fatalf("RunExplain = %v, %v; expected the large rule set to match", matchIDs(matches), err)
+	}
+	// the rule sets after the first match are not evaluated, so they have no trace
+	if len(traces) != 2 || traces["gold"] == nil || traces["gold"].Result || traces["large"] == nil || !traces["large"].Result {
+		t.Errorf("traces = %v; expected the traces of gold and large", traces)
+	}
+
+	matches, traces, err = newTestEngine(t, AllMatches).RunExplain(`{"total":10,"tier":"gold"}`)
+	if !errors.Is(err, ErrMissingField) || len(matches) != 2 || len(traces) != 4 || traces["country"].Error == "" {
+		t.Errorf("RunExplain = %v, %v, %v; expected the trace of the failing rule set too", matchIDs(matches), traces, err)
+	}
+}
+
+func TestEngineAddAndRemove(t *testing.T) {
+	engine := newTestEngine(t, AllMatches)
+	engine.Remove("large")
+	if err := engine.Add("gold", 0, `{"conditions":[]}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ids := engine.IDs(); !reflect.DeepEqual(ids, []string{"country", "standard", "gold"}) {
+		t.Errorf("IDs() = %v", ids)
+	}
+
+	entries := engine.Entries()
+	if len(entries) != 3 || entries[0].ID != "country" || entries[0].Priority != 5 || entries[0].Program == nil {
+		t.Errorf("Entries() = %+v", entries)
+	}
+	if entry, exists := engine.Entry("gold"); !exists || entry.Priority != 0 {
+		t.Errorf("Entry(gold) = %+v, %v", entry, exists)
+	}
+	if _, exists := engine.Entry("large"); exists {
+		t.Errorf("expected a removed rule set not to exist")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			engine.Run(`{"total":10,"tier":"gold","country":"Turkey"}`)
+		}()
+		go func() {
+			defer wg.Done()
+			engine.Add("large", 5, `{"conditions":[]}`)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEngineReplace(t *testing.T) {
+	engine := newTestEngine(t, AllMatches)
+	gold, _ := engine.Entry("gold")
+	large, err := Compile(`{"conditions":[]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	engine.Replace([]EngineEntry{
+		{ID: "gold", Program: gold.Program},
+		{ID: "large", Priority: 5, Program: large},
+		{ID: "gold", Priority: 10, Program: large},
+	})
+	if ids := engine.IDs(); !reflect.DeepEqual(ids, []string{"large", "gold"}) {
+		t.Errorf("IDs() = %v; expected the replaced rule sets by priority", ids)
+	}
+	if entry, _ := engine.Entry("gold"); entry.Program != gold.Program {
+		t.Errorf("Entry(gold) = %+v; expected the first entry of an id to win", entry)
+	}
+
+	engine.Replace(nil)
+	if ids := engine.IDs(); len(ids) != 0 {
+		t.Errorf("IDs() = %v; expected no rule set", ids)
+	}
+}
+
+func TestEngineRunContext(t *testing.T) {
+	engine := newTestEngine(t, AllMatches)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	matches, err := engine.RunContext(ctx, `{"tier":"gold","total":50}`)
+	if matches != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("RunContext() = %v, %v; expected %v", matchIDs(matches), err, context.Canceled)
+	}
+	var ruleSetErr *RuleSetError
+	if errors.As(err, &ruleSetErr) {
+		t.Errorf("RunContext() error = %v; expected only the error of the context", err)
+	}
+
+	matches, err = engine.RunContext(context.Background(), `{"tier":"gold","total":50,"country":"Germany"}`)
+	if err != nil || len(matches) != 2 {
+		t.Errorf("RunContext() = %v, %v; expected gold and standard", matchIDs(matches), err)
+	}
+}
@@ -0,0 +1,129 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by Evaluate, they can be matched with errors.Is
+var (
+	ErrInvalidRules            = errors.New("rule: invalid rules")
+	ErrInvalidInput            = errors.New("rule: invalid input")
+	ErrUnknownOperator         = errors.New("rule: unknown operator")
+	ErrMissingField            = errors.New("rule: missing field")
+	ErrCustomOperationNotFound = errors.New("rule: custom operation not found")
+	ErrTypeMismatch            = errors.New("rule: type mismatch")
+	// ErrUnknownField is returned by Compile for a field missing from the schema given with WithSchema
+	ErrUnknownField = errors.New("rule: unknown field")
+	// ErrHitPolicyViolation is returned when more than one row of a decision table with the
+	// unique hit policy matches an input
+	ErrHitPolicyViolation = errors.New("rule: hit policy violation")
+)
+
+// RuleError describes a failure caused by a single rule of a RuleSet
+type RuleError struct {
+	// Path is the location of the rule in the RuleSet, e.g. "conditions[0].all[1]"
+	Path string
+	Rule Rule
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	// a type mismatch already names the field and the operator
+	var mismatch *TypeMismatchError
+	if errors.As(e.Err, &mismatch) && mismatch.Field == e.Rule.Field && mismatch.Operator == e.Rule.Operator {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s: %v (field %q, operator %q)", e.Path, e.Err, e.Rule.Field, e.Rule.Operator)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// childPath builds the location of a nested rule, e.g. "conditions[0].all[1]"
+func childPath(parent, group string, index int) string {
+	return fmt.Sprintf("%s.%s[%d]", parent, group, index)
+}
+
+// TypeMismatchError describes an operand whose type the operator cannot handle
+type TypeMismatchError struct {
+	Field    string
+	Operator string
+	// Operand is "field" for the field value and "value" for the rule value
+	Operand  string
+	Expected string
+	Actual   string
+}
+
+func (e *TypeMismatchError) Error() string {
+	message := ErrTypeMismatch.Error() + ": "
+	if e.Operator != "" {
+		message += fmt.Sprintf("operator %q ", e.Operator)
+	}
+	message += fmt.Sprintf("expects %s %s %s", article(e.Expected), e.Expected, e.Operand)
+	if e.Field != "" {
+		message += fmt.Sprintf(" for field %q", e.Field)
+	}
+	return message + ", got " + e.Actual
+}
+
+// article returns the indefinite article of a word, e.g. "an" for "array"
+func article(word string) string {
+	if word != "" && strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// Is makes every TypeMismatchError match ErrTypeMismatch
+func (e *TypeMismatchError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
+
+// invalidRules wraps an error of a rule in ErrInvalidRules, the "rule: " prefix of its message
+// is not repeated
+func invalidRules(err error) error {
+	return &wrappedError{sentinel: ErrInvalidRules, err: err}
+}
+
+// wrappedError is an error wrapped in a sentinel error of the package
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *wrappedError) Error() string {
+	return e.sentinel.Error() + ": " + strings.TrimPrefix(e.err.Error(), "rule: ")
+}
+
+func (e *wrappedError) Unwrap() []error {
+	return []error{e.sentinel, e.err}
+}
+
+// locateMismatch names the field and operator of a rule in a TypeMismatchError held by err
+func locateMismatch(err error, rule Rule) error {
+	var mismatch *TypeMismatchError
+	if errors.As(err, &mismatch) {
+		mismatch.Field = rule.Field
+		mismatch.Operator = rule.Operator
+	}
+	return err
+}
+
+func fieldMismatch(expected string, actual interface{}) error {
+	return &TypeMismatchError{Operand: "field", Expected: expected, Actual: typeName(actual)}
+}
+
+func valueMismatch(expected string, actual interface{}) error {
+	return &TypeMismatchError{Operand: "value", Expected: expected, Actual: typeName(actual)}
+}
+
+// typeName names the dynamic type of a value for error messages
+func typeName(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,427 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// symbolOperators are the operators written as symbols in expressions
+var symbolOperators = map[string]string{
+	"==": "equals",
+	"!=": "notEquals",
+	">":  "greaterThan",
+	"<":  "lessThan",
+	">=": "greaterThanInclusive",
+	"<=": "lessThanInclusive",
+}
+
+// exprNode is a parsed expression: a comparison, or "and", "or" or "not" of nested expressions
+type exprNode struct {
+	kind     string
+	rule     Rule
+	children []*exprNode
+	offset   int
+}
+
+// exprParser parses expressions such as `country in ["Turkey"] and not city startsWith "Lon"`,
+// "not" binds tighter than "and", which binds tighter than "or"
+type exprParser struct {
+	src string
+	pos int
+}
+
+// parseExpression parses an expression into a rule set holding a single condition set, with
+// the positions of its rules
+func parseExpression(src string) (RuleSet, map[string]position, error) {
+	p := &exprParser{src: src}
+	p.skipSpace()
+	if p.pos == len(src) {
+		return RuleSet{}, map[string]position{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return RuleSet{}, nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(src) {
+		return RuleSet{}, nil, p.errorf("unexpected %q", p.rest(10))
+	}
+
+	positions := map[string]position{}
+	path := "conditions[0]"
+	conditionSet := ConditionSet{}
+	switch root.kind {
+	case "and":
+		conditionSet.All = p.rules(root.children, path, "all", positions)
+	case "or":
+		conditionSet.Any = p.rules(root.children, path, "any", positions)
+	case "not":
+		not := p.rule(root.children[0], path+".not", positions)
+		conditionSet.Not = &not
+	default:
+		conditionSet.All = p.rules([]*exprNode{root}, path, "all", positions)
+	}
+	return RuleSet{Conditions: []ConditionSet{conditionSet}}, positions, nil
+}
+
+// rules converts the nodes of a group into rules, recording their positions
+func (p *exprParser) rules(nodes []*exprNode, path, group string, positions map[string]position) []Rule {
+	rules := make([]Rule, 0, len(nodes))
+	for i, n := range nodes {
+		rules = append(rules, p.rule(n, childPath(path, group, i), positions))
+	}
+	return rules
+}
+
+// rule converts a node into a rule, recording its position and the positions of its nested rules
+func (p *exprParser) rule(n *exprNode, path string, positions map[string]position) Rule {
+	line, column := offsetPosition([]byte(p.src), int64(n.offset))
+	positions[path] = position{line: line, column: column}
+	switch n.kind {
+	case "and":
+		return Rule{All: p.rules(n.children, path, "all", positions)}
+	case "or":
+		return Rule{Any: p.rules(n.children, path, "any", positions)}
+	case "not":
+		not := p.rule(n.children[0], path+".not", positions)
+		return Rule{Not: &not}
+	}
+	return n.rule
+}
+
+func (p *exprParser) parseOr() (*exprNode, error) {
+	return p.parseChain("or", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	return p.parseChain("and", p.parseNot)
+}
+
+// parseChain parses operands joined by the keyword into a single node
+func (p *exprParser) parseChain(keyword string, operand func() (*exprNode, error)) (*exprNode, error) {
+	offset := p.skipSpace()
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	chain := &exprNode{kind: keyword, children: []*exprNode{first}, offset: offset}
+	for p.keyword(keyword) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		chain.children = append(chain.children, next)
+	}
+	if len(chain.children) == 1 {
+		return first, nil
+	}
+	return chain, nil
+}
+
+func (p *exprParser) parseNot() (*exprNode, error) {
+	offset := p.skipSpace()
+	if p.keyword("not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{kind: "not", children: []*exprNode{operand}, offset: offset}, nil
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '(' {
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.src) || p.src[p.pos] != ')' {
+			return nil, p.errorf("expected %q", ")")
+		}
+		p.pos++
+		// a parenthesised expression keeps its own group, and is located at its parenthesis
+		n.offset = offset
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses `field operator value`
+func (p *exprParser) parseComparison() (*exprNode, error) {
+	offset := p.skipSpace()
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	operator := p.parseOperator()
+	if operator == "" {
+		return nil, p.errorf("expected an operator after field %q", field)
+	}
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &exprNode{rule: Rule{Field: field, Operator: operator, Value: value}, offset: offset}, nil
+}
+
+// parseField parses a field path, or any field name quoted with backticks
+func (p *exprParser) parseField() (string, error) {
+	start := p.pos
+	if p.pos < len(p.src) && p.src[p.pos] == '`' {
+		end := strings.IndexByte(p.src[p.pos+1:], '`')
+		if end < 0 {
+			return "", p.errorf("unterminated field name")
+		}
+		p.pos += end + 2
+		return p.src[start+1 : p.pos-1], nil
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '\\' && p.pos+1 < len(p.src) {
+			p.pos += 2
+			continue
+		}
+		if !isFieldByte(c) {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		if p.pos == len(p.src) {
+			return "", p.errorf("unexpected end of expression, expected a field")
+		}
+		return "", p.errorf("expected a field, got %q", p.rest(1))
+	}
+	return p.src[start:p.pos], nil
+}
+
+// parseOperator parses a symbol such as ">=" or a name such as "startsWith" or "custom.check"
+func (p *exprParser) parseOperator() string {
+	for _, symbol := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if strings.HasPrefix(p.src[p.pos:], symbol) {
+			p.pos += len(symbol)
+			return symbolOperators[symbol]
+		}
+	}
+	start := p.pos
+	if p.pos == len(p.src) || !unicode.IsLetter(rune(p.src[p.pos])) {
+		return ""
+	}
+	for p.pos < len(p.src) && isOperatorByte(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parseValue parses a JSON value, so values have the same types as in JSON rules
+func (p *exprParser) parseValue() (interface{}, error) {
+	if p.pos == len(p.src) {
+		return nil, p.errorf("unexpected end of expression, expected a value")
+	}
+	decoder := json.NewDecoder(strings.NewReader(p.src[p.pos:]))
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			p.pos += int(max(syntaxErr.Offset-1, 0))
+		}
+		return nil, p.errorf("invalid value: %v", err)
+	}
+	p.pos += int(decoder.InputOffset())
+	return value, nil
+}
+
+// keyword consumes the keyword when it is the next word
+func (p *exprParser) keyword(word string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], word) {
+		return false
+	}
+	end := p.pos + len(word)
+	if end < len(p.src) && isOperatorByte(p.src[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// skipSpace skips white space and returns the new position
+func (p *exprParser) skipSpace() int {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.pos
+}
+
+// rest returns up to n bytes from the position, for error messages
+func (p *exprParser) rest(n int) string {
+	return p.src[p.pos:min(p.pos+n, len(p.src))]
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	line, column := offsetPosition([]byte(p.src), int64(p.pos))
+	return &SourceError{Format: FormatExpression, Line: line, Column: column, Err: fmt.Errorf("%w: %s", ErrInvalidRules, fmt.Sprintf(format, args...))}
+}
+
+// isFieldByte reports whether c can be part of a field path that is not quoted
+func isFieldByte(c byte) bool {
+	return isOperatorByte(c) || strings.IndexByte("$@-[]*", c) >= 0 || c >= 0x80
+}
+
+// isOperatorByte reports whether c can be part of an operator name or a keyword
+func isOperatorByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// marshalExpression writes the conditions of a rule set as an expression
+func marshalExpression(ruleSet RuleSet) ([]byte, error) {
+	if len(ruleSet.Event) > 0 || len(ruleSet.Actions) > 0 || len(ruleSet.OnFailure) > 0 || ruleSet.Score != 0 || ruleSet.Priority != 0 || ruleSet.Scoring != nil || !ruleSet.isZero() {
+		return nil, fmt.Errorf("%w: an expression can only hold the conditions of a rule set", ErrInvalidRules)
+	}
+
+	var buf bytes.Buffer
+	for i, conditionSet := range ruleSet.Conditions {
+		if conditionSet.Weight != 0 {
+			return nil, fmt.Errorf("%w: conditions[%d]: an expression can not hold weights", ErrInvalidRules, i)
+		}
+		text, kind, err := printGroup(conditionSet.All, conditionSet.Any, conditionSet.None, conditionSet.Not)
+		if err != nil {
+			return nil, fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+		if len(ruleSet.Conditions) > 1 && kind == "or" {
+			text = "(" + text + ")"
+		}
+		if i > 0 {
+			buf.WriteString(" and ")
+		}
+		buf.WriteString(text)
+	}
+	return buf.Bytes(), nil
+}
+
+// printGroup writes the parts of a group joined by "and", and returns the kind of the
+// expression, "and", "or", "not" or "" for a comparison or a parenthesised expression
+func printGroup(all, any, none []Rule, not *Rule) (string, string, error) {
+	type term struct {
+		text string
+		kind string
+	}
+	var terms []term
+
+	for _, rule := range all {
+		text, kind, err := printRule(rule)
+		if err != nil {
+			return "", "", err
+		}
+		terms = append(terms, term{parenthesize(text, kind), kindOf(kind)})
+	}
+	if len(any) > 0 {
+		alternatives := make([]string, 0, len(any))
+		for _, rule := range any {
+			text, kind, err := printRule(rule)
+			if err != nil {
+				return "", "", err
+			}
+			alternatives = append(alternatives, parenthesize(text, kind))
+		}
+		if len(alternatives) == 1 {
+			terms = append(terms, term{alternatives[0], ""})
+		} else {
+			terms = append(terms, term{strings.Join(alternatives, " or "), "or"})
+		}
+	}
+	// none passes when no nested rule passes, that is when each of them does not
+	for _, rule := range none {
+		text, kind, err := printRule(rule)
+		if err != nil {
+			return "", "", err
+		}
+		terms = append(terms, term{"not " + parenthesize(text, kind), "not"})
+	}
+	if not != nil {
+		text, kind, err := printRule(*not)
+		if err != nil {
+			return "", "", err
+		}
+		terms = append(terms, term{"not " + parenthesize(text, kind), "not"})
+	}
+
+	switch len(terms) {
+	case 0:
+		return "", "", fmt.Errorf("%w: an empty group can not be written as an expression", ErrInvalidRules)
+	case 1:
+		return terms[0].text, terms[0].kind, nil
+	}
+	texts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		texts = append(texts, parenthesize(t.text, t.kind))
+	}
+	return strings.Join(texts, " and "), "and", nil
+}
+
+// printRule writes a comparison, or the nested rules of a group
+func printRule(rule Rule) (string, string, error) {
+	if !rule.isZero() {
+		return "", "", fmt.Errorf("%w: an expression can not hold the metadata of a rule", ErrInvalidRules)
+	}
+	if rule.Weight != 0 {
+		return "", "", fmt.Errorf("%w: an expression can not hold weights", ErrInvalidRules)
+	}
+	if rule.IsGroup() {
+		return printGroup(rule.All, rule.Any, rule.None, rule.Not)
+	}
+
+	value, err := json.Marshal(rule.Value)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+	operator := rule.Operator
+	for symbol, name := range symbolOperators {
+		if name == operator {
+			operator = symbol
+		}
+	}
+	return printField(rule.Field) + " " + operator + " " + string(value), "", nil
+}
+
+// printField quotes a field with backticks when it can not be written as is
+func printField(field string) string {
+	quote := field == "" || field == "and" || field == "or" || field == "not"
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' {
+			i++
+			continue
+		}
+		if !isFieldByte(field[i]) {
+			quote = true
+		}
+	}
+	if quote {
+		return "`" + field + "`"
+	}
+	return field
+}
+
+// parenthesize wraps an "and" or an "or" in parentheses so it is parsed back as the same
+// nested group, "not" binds tighter than both so it never needs them
+func parenthesize(text, kind string) string {
+	if kind == "and" || kind == "or" {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// kindOf returns the kind of an expression once it is parenthesised
+func kindOf(kind string) string {
+	if kind == "and" || kind == "or" {
+		return ""
+	}
+	return kind
+}
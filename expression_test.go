@@ -0,0 +1,153 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		rules      string
+	}{
+		{
+			`country in ["Turkey","England"] and population > 19000 and not city startsWith "Lon"`,
+			`{"conditions":[{"all":[
+				{"field":"country","operator":"in","value":["Turkey","England"]},
+				{"field":"population","operator":"greaterThan","value":19000},
+				{"not":{"field":"city","operator":"startsWith","value":"Lon"}}
+			]}]}`,
+		},
+		{
+			`a == 1 or (b != "x" and c.d[0] >= 2.5) or not (e < 1 or f <= 2)`,
+			`{"conditions":[{"any":[
+				{"field":"a","operator":"equals","value":1},
+				{"all":[{"field":"b","operator":"notEquals","value":"x"},{"field":"c.d[0]","operator":"greaterThanInclusive","value":2.5}]},
+				{"not":{"any":[{"field":"e","operator":"lessThan","value":1},{"field":"f","operator":"lessThanInclusive","value":2}]}}
+			]}]}`,
+		},
+		{
+			`(a == 1 and b == 2) and c == 3`,
+			`{"conditions":[{"all":[
+				{"all":[{"field":"a","operator":"equals","value":1},{"field":"b","operator":"equals","value":2}]},
+				{"field":"c","operator":"equals","value":3}
+			]}]}`,
+		},
+		{
+			`not a == null`,
+			`{"conditions":[{"not":{"field":"a","operator":"equals","value":null}}]}`,
+		},
+		{
+			"`first name` == \"Ali\" and external.score custom.check {\"min\":1}",
+			`{"conditions":[{"all":[
+				{"field":"first name","operator":"equals","value":"Ali"},
+				{"field":"external.score","operator":"custom.check","value":{"min":1}}
+			]}]}`,
+		},
+		{``, `{}`},
+	}
+
+	for _, test := range tests {
+		ruleSet, err := ParseRuleSet([]byte(test.expression), FormatExpression)
+		if err != nil {
+			t.Errorf("ParseRuleSet(%q) error = %v", test.expression, err)
+			continue
+		}
+		var expected RuleSet
+		if err := json.Unmarshal([]byte(test.rules), &expected); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(ruleSet, expected) {
+			t.Errorf("ParseRuleSet(%q) = %+v; expected %+v", test.expression, ruleSet, expected)
+		}
+
+		// the expression printed from the rule set is the canonical one
+		printed, err := MarshalRuleSet(ruleSet, FormatExpression)
+		if err != nil || string(printed) != test.expression {
+			t.Errorf("MarshalRuleSet(%q) = %q, %v", test.expression, printed, err)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		line       int
+		column     int
+		path       string
+		err        error
+	}{
+		{`a == 1 and`, 1, 11, "", ErrInvalidRules},
+		{`a 1`, 1, 3, "", ErrInvalidRules},
+		{`a == Turkey`, 1, 6, "", ErrInvalidRules},
+		{`(a == 1`, 1, 8, "", ErrInvalidRules},
+		{`a == 1 b == 2`, 1, 8, "", ErrInvalidRules},
+		{"`a == 1", 1, 1, "", ErrInvalidRules},
+		{"a == 1 and\n  (b eq 2 or c == 3)", 2, 4, "conditions[0].all[1].any[0]", ErrUnknownOperator},
+		{`a == 1 and b in "x"`, 1, 12, "conditions[0].all[1]", ErrInvalidRules},
+	}
+
+	for _, test := range tests {
+		_, err := CompileDocument([]byte(test.expression), FormatExpression)
+		var sourceErr *SourceError
+		if !errors.Is(err, test.err) || !errors.As(err, &sourceErr) {
+			t.Errorf("%q: error = %v; expected %v", test.expression, err, test.err)
+			continue
+		}
+		if sourceErr.Line != test.line || sourceErr.Column != test.column || sourceErr.Path != test.path {
+			t.Errorf("%q: error at %d:%d %q; expected %d:%d %q", test.expression, sourceErr.Line, sourceErr.Column, sourceErr.Path, test.line, test.column, test.path)
+		}
+	}
+}
+
+func TestMarshalExpression(t *testing.T) {
+	rules := `{"conditions":[
+		{
+			"all":[{"field":"a","operator":"equals","value":1}],
+			"any":[{"field":"b","operator":"in","value":[1,2]},{"field":"c","operator":"regex","value":"^x"}],
+			"none":[{"field":"d","operator":"equals","value":true}],
+			"not":{"all":[{"field":"e","operator":"equals","value":null},{"field":"f","operator":"equals","value":2}]}
+		},
+		{"any":[{"field":"g","operator":"equals","value":1},{"field":"h","operator":"equals","value":1}]}
+	]}`
+	expected := `a == 1 and (b in [1,2] or c regex "^x") and not d == true and not (e == null and f == 2) and (g == 1 or h == 1)`
+
+	ruleSet, err := ParseRuleSet([]byte(rules), FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	printed, err := MarshalRuleSet(ruleSet, FormatExpression)
+	if err != nil || string(printed) != expected {
+		t.Errorf("MarshalRuleSet() = %s, %v; expected %s", printed, err, expected)
+	}
+
+	// the expression has the meaning of the rule set
+	program, err := CompileDocument(printed, FormatExpression)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inputs := []string{
+		`{"a":1,"b":2,"c":"y","d":false,"e":1,"f":2,"g":1,"h":0}`,
+		`{"a":1,"b":3,"c":"xy","d":false,"e":null,"f":2,"g":0,"h":1}`,
+		`{"a":1,"b":3,"c":"y","d":false,"e":1,"f":2,"g":1,"h":1}`,
+		`{"a":1,"b":1,"c":"y","d":true,"e":1,"f":2,"g":1,"h":1}`,
+	}
+	for _, input := range inputs {
+		expected, err := Evaluate(input, rules, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result, err := program.Eval(input); result != expected || err != nil {
+			t.Errorf("Eval(%s) = %v, %v; expected %v", input, result, err, expected)
+		}
+	}
+
+	if _, err := MarshalRuleSet(RuleSet{Conditions: []ConditionSet{{}}}, FormatExpression); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("error = %v; expected an empty condition set to be rejected", err)
+	}
+	if _, err := MarshalRuleSet(RuleSet{Score: 1}, FormatExpression); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("error = %v; expected a scored rule set to be rejected", err)
+	}
+}
@@ -0,0 +1,763 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a rule document
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+	// FormatExpression is the expression syntax, e.g. `country == "Turkey" and population > 1000`,
+	// it holds the conditions of a rule set only
+	FormatExpression Format = "expression"
+)
+
+// FormatOf returns the format of a rule document from the extension of its path
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".expr":
+		return FormatExpression, nil
+	}
+	return "", fmt.Errorf("%w: unknown format of %q", ErrInvalidRules, path)
+}
+
+// SourceError locates an error in a rule document
+type SourceError struct {
+	Format Format
+	// Line and Column start at 1, they are 0 when the location is not known
+	Line   int
+	Column int
+	// Path is the location of the offending rule or field, e.g. "conditions[0].all[1]",
+	// it is empty for syntax errors
+	Path string
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	message := e.Err.Error()
+	// a RuleError already starts with the path
+	var ruleErr *RuleError
+	if e.Path != "" && !errors.As(e.Err, &ruleErr) {
+		message = e.Path + ": " + message
+	}
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.Format, e.Line, e.Column, message)
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Format, e.Line, message)
+	}
+	return fmt.Sprintf("%s: %s", e.Format, message)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRuleSet decodes a rule document. YAML and TOML documents have the same fields and
+// semantics as JSON ones. Errors are SourceErrors matching ErrInvalidRules.
+func ParseRuleSet(data []byte, format Format) (RuleSet, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	return doc.ruleSet()
+}
+
+// CompileDocument parses a rule document and compiles it like CompileRuleSet does, errors
+// are SourceErrors locating the offending rule in the document
+func CompileDocument(data []byte, format Format, opts ...Option) (*Program, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+	ruleSet, err := doc.ruleSet()
+	if err != nil {
+		return nil, err
+	}
+	program, err := CompileRuleSet(ruleSet, opts...)
+	if err != nil {
+		var ruleErr *RuleError
+		if errors.As(err, &ruleErr) {
+			return nil, doc.errorAt(ruleErr.Path, err)
+		}
+		return nil, doc.errorAt("", err)
+	}
+	return program, nil
+}
+
+// MarshalRuleSet encodes a rule set as a rule document of the format, parsing the
+// document returns the same rule set
+func MarshalRuleSet(ruleSet RuleSet, format Format) ([]byte, error) {
+	if format == FormatExpression {
+		return marshalExpression(ruleSet)
+	}
+	data, err := json.MarshalIndent(ruleSet, "", "  ")
+	if err != nil || format == FormatJSON {
+		return data, err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value = plainValue(value)
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := toml.NewEncoder(&buf).Encode(value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidRules, format)
+	}
+	return buf.Bytes(), nil
+}
+
+// plainValue turns the numbers of a decoded JSON value into ints or floats and drops the
+// null fields, which YAML and TOML encoders do not handle like JSON
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = plainValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = plainValue(item)
+		}
+	}
+	return value
+}
+
+// document is a parsed rule document
+type document struct {
+	format Format
+	data   []byte
+	// value is the document decoded into JSON values
+	value interface{}
+	// node is the node tree of YAML documents, it locates their rules
+	node *yaml.Node
+	// located holds the positions of the rules of expressions, which are found while parsing
+	located map[string]position
+}
+
+// position is a line and a column in a document, starting at 1
+type position struct {
+	line   int
+	column int
+}
+
+// parseDocument decodes a rule document into JSON values
+func parseDocument(data []byte, format Format) (*document, error) {
+	d := &document{format: format, data: data}
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &d.value); err != nil {
+			return nil, d.syntaxError(err)
+		}
+		return d, nil
+	case FormatYAML:
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, d.syntaxError(err)
+		}
+		d.node = &node
+		value, err := yamlValue(&node)
+		if err != nil {
+			return nil, d.syntaxError(err)
+		}
+		d.value = value
+	case FormatTOML:
+		var value map[string]interface{}
+		if _, err := toml.Decode(string(data), &value); err != nil {
+			return nil, d.syntaxError(err)
+		}
+		d.value = value
+	case FormatExpression:
+		ruleSet, positions, err := parseExpression(string(data))
+		if err != nil {
+			return nil, err
+		}
+		d.value, d.located = ruleSet, positions
+		return d, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidRules, format)
+	}
+
+	d.value = jsonValue(d.value)
+	return d, nil
+}
+
+// yamlValue decodes a YAML node tree into the values a JSON document with the same text
+// holds: numbers are float64s, and scalars JSON has no syntax for, e.g. timestamps or 0755,
+// are kept as their text
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.SequenceNode:
+		list := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			value, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case yaml.MappingNode:
+		obj := make(map[string]interface{}, len(node.Content)/2)
+		var merged []map[string]interface{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, child := node.Content[i], node.Content[i+1]
+			if key.Kind == yaml.AliasNode {
+				key = key.Alias
+			}
+			value, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			if key.ShortTag() == "!!merge" {
+				// the keys of a merged mapping do not override the keys of the mapping
+				switch value := value.(type) {
+				case map[string]interface{}:
+					merged = append(merged, value)
+				case []interface{}:
+					for _, item := range value {
+						if item, ok := item.(map[string]interface{}); ok {
+							merged = append(merged, item)
+						}
+					}
+				}
+				continue
+			}
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("yaml: line %d: a key is not a scalar", key.Line)
+			}
+			obj[key.Value] = value
+		}
+		for _, values := range merged {
+			for key, value := range values {
+				if _, exists := obj[key]; !exists {
+					obj[key] = value
+				}
+			}
+		}
+		return obj, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var value bool
+		err := node.Decode(&value)
+		return value, err
+	case "!!int", "!!float":
+		var value float64
+		if json.Unmarshal([]byte(node.Value), &value) == nil {
+			return value, nil
+		}
+	}
+	return node.Value, nil
+}
+
+// jsonValue converts the arrays of tables TOML decodes to JSON arrays
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = jsonValue(item)
+		}
+		return list
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// ruleSet decodes the document into a RuleSet the way JSON documents are decoded
+func (d *document) ruleSet() (RuleSet, error) {
+	data := d.data
+	if d.format != FormatJSON {
+		var err error
+		if data, err = json.Marshal(d.value); err != nil {
+			return RuleSet{}, d.errorAt("", fmt.Errorf("%w: %w", ErrInvalidRules, err))
+		}
+	}
+	var ruleSet RuleSet
+	if err := json.Unmarshal(data, &ruleSet); err != nil {
+		return RuleSet{}, d.errorAt(locateInvalid(d.value), fmt.Errorf("%w: %w", ErrInvalidRules, err))
+	}
+	return ruleSet, nil
+}
+
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+):`)
+
+// syntaxError locates an error of the decoder of the document
+func (d *document) syntaxError(err error) error {
+	e := &SourceError{Format: d.format, Err: fmt.Errorf("%w: %w", ErrInvalidRules, err)}
+	var jsonErr *json.SyntaxError
+	var tomlErr toml.ParseError
+	switch {
+	case errors.As(err, &jsonErr):
+		// the offset is past the offending byte
+		e.Line, e.Column = offsetPosition(d.data, max(jsonErr.Offset-1, 0))
+	case errors.As(err, &tomlErr):
+		e.Line, e.Column = tomlErr.Position.Line, tomlErr.Position.Col
+	default:
+		if match := yamlLine.FindStringSubmatch(err.Error()); match != nil {
+			e.Line, _ = strconv.Atoi(match[1])
+		}
+	}
+	return e
+}
+
+// errorAt locates an error caused by the value at the path of the document
+func (d *document) errorAt(path string, err error) error {
+	e := &SourceError{Format: d.format, Path: path, Err: err}
+	if path != "" {
+		pos := d.positions()[path]
+		e.Line, e.Column = pos.line, pos.column
+	}
+	return e
+}
+
+// positions maps the paths of the values of the document to their positions
+func (d *document) positions() map[string]position {
+	if d.located != nil {
+		return d.located
+	}
+	positions := map[string]position{}
+	switch d.format {
+	case FormatJSON:
+		jsonPositions(d.data, positions)
+	case FormatYAML:
+		yamlPositions(d.node, "", positions)
+	case FormatTOML:
+		tomlPositions(d.data, positions)
+	}
+	return positions
+}
+
+// jsonPositions records the positions of the values of a JSON document
+func jsonPositions(data []byte, positions map[string]position) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var walk func(path string) error
+	walk = func(path string) error {
+		offset := decoder.InputOffset()
+		for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,:", rune(data[offset])) {
+			offset++
+		}
+		line, column := offsetPosition(data, offset)
+		positions[path] = position{line: line, column: column}
+
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'):
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(joinKey(path, fmt.Sprint(key))); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		case json.Delim('['):
+			for i := 0; decoder.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		}
+		return err
+	}
+	walk("")
+}
+
+// yamlPositions records the positions of the values of a YAML node tree
+func yamlPositions(node *yaml.Node, path string, positions map[string]position) {
+	if node == nil {
+		return
+	}
+	if node.Kind != yaml.DocumentNode {
+		positions[path] = position{line: node.Line, column: node.Column}
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			yamlPositions(child, path, positions)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			yamlPositions(node.Content[i+1], joinKey(path, node.Content[i].Value), positions)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			yamlPositions(child, fmt.Sprintf("%s[%d]", path, i), positions)
+		}
+	}
+}
+
+// tomlPositions records the positions of the tables and values of a TOML document. The
+// decoder does not report them, so the document, which it already accepted, is scanned for
+// its table headers, keys and the items of its arrays and inline tables.
+func tomlPositions(data []byte, positions map[string]position) {
+	s := &tomlScanner{data: data, positions: positions, tables: map[string]int{}}
+	table := ""
+	for {
+		s.skipSpace(true)
+		if s.offset >= len(data) {
+			return
+		}
+		start := s.offset
+		if data[s.offset] == '[' {
+			array := bytes.HasPrefix(data[s.offset:], []byte("[["))
+			s.offset++
+			if array {
+				s.offset++
+			}
+			table = s.tablePath(s.keys(), array)
+			s.mark(table, start)
+			s.skipLine()
+			continue
+		}
+		keys := s.keys()
+		if len(keys) == 0 || s.offset >= len(data) || data[s.offset] != '=' {
+			return
+		}
+		s.offset++
+		s.skipSpace(false)
+		s.value(joinKeys(table, keys))
+	}
+}
+
+// tomlScanner walks a TOML document recording the positions of its values
+type tomlScanner struct {
+	data      []byte
+	offset    int
+	positions map[string]position
+	// tables counts the tables of every array of tables by its path
+	tables map[string]int
+}
+
+// mark records the position of the value at the path
+func (s *tomlScanner) mark(path string, offset int) {
+	line, column := offsetPosition(s.data, int64(offset))
+	s.positions[path] = position{line: line, column: column}
+}
+
+// tablePath returns the path of a table header, the keys of an array of tables point into
+// its last table
+func (s *tomlScanner) tablePath(keys []string, array bool) string {
+	path := ""
+	for i, key := range keys {
+		path = joinKey(path, key)
+		if n, ok := s.tables[path]; ok && i < len(keys)-1 {
+			path = fmt.Sprintf("%s[%d]", path, n-1)
+		}
+	}
+	if array {
+		n := s.tables[path]
+		s.tables[path] = n + 1
+		path = fmt.Sprintf("%s[%d]", path, n)
+	}
+	return path
+}
+
+// keys reads a dotted key, e.g. `conditions.all` or `"first name"`
+func (s *tomlScanner) keys() []string {
+	var keys []string
+	for {
+		s.skipSpace(false)
+		if s.offset >= len(s.data) {
+			return keys
+		}
+		start := s.offset
+		switch s.data[s.offset] {
+		case '"', '\'':
+			s.str()
+			key := string(s.data[start+1 : s.offset-1])
+			if s.data[start] == '"' {
+				if unquoted, err := strconv.Unquote(string(s.data[start:s.offset])); err == nil {
+					key = unquoted
+				}
+			}
+			keys = append(keys, key)
+		default:
+			for s.offset < len(s.data) && bareKey(s.data[s.offset]) {
+				s.offset++
+			}
+			if s.offset == start {
+				return keys
+			}
+			keys = append(keys, string(s.data[start:s.offset]))
+		}
+		s.skipSpace(false)
+		if s.offset >= len(s.data) || s.data[s.offset] != '.' {
+			return keys
+		}
+		s.offset++
+	}
+}
+
+// bareKey reports whether a byte can be part of a bare key
+func bareKey(b byte) bool {
+	return b == '_' || b == '-' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// value records the position of the value at the offset and of the items it holds
+func (s *tomlScanner) value(path string) {
+	s.mark(path, s.offset)
+	if s.offset >= len(s.data) {
+		return
+	}
+	switch s.data[s.offset] {
+	case '[':
+		s.offset++
+		for i := 0; ; {
+			s.skipSpace(true)
+			if s.offset >= len(s.data) {
+				return
+			}
+			switch s.data[s.offset] {
+			case ']':
+				s.offset++
+				return
+			case ',':
+				s.offset++
+				continue
+			}
+			start := s.offset
+			s.value(fmt.Sprintf("%s[%d]", path, i))
+			if s.offset == start {
+				return
+			}
+			i++
+		}
+	case '{':
+		s.offset++
+		for {
+			s.skipSpace(true)
+			if s.offset >= len(s.data) {
+				return
+			}
+			switch s.data[s.offset] {
+			case '}':
+				s.offset++
+				return
+			case ',':
+				s.offset++
+				continue
+			}
+			keys := s.keys()
+			if len(keys) == 0 || s.offset >= len(s.data) || s.data[s.offset] != '=' {
+				return
+			}
+			s.offset++
+			s.skipSpace(false)
+			s.value(joinKeys(path, keys))
+		}
+	case '"', '\'':
+		s.str()
+	default:
+		for s.offset < len(s.data) && !strings.ContainsRune(",]}\n#", rune(s.data[s.offset])) {
+			s.offset++
+		}
+	}
+}
+
+// str skips a basic, literal or multi-line string
+func (s *tomlScanner) str() {
+	quote := s.data[s.offset]
+	delimiter := []byte{quote}
+	if bytes.HasPrefix(s.data[s.offset:], []byte{quote, quote, quote}) {
+		delimiter = []byte{quote, quote, quote}
+	}
+	s.offset += len(delimiter)
+	for s.offset < len(s.data) {
+		if quote == '"' && s.data[s.offset] == '\\' {
+			s.offset += 2
+			continue
+		}
+		if bytes.HasPrefix(s.data[s.offset:], delimiter) {
+			s.offset += len(delimiter)
+			// a multi-line string can end with up to two more quotes
+			for len(delimiter) == 3 && s.offset < len(s.data) && s.data[s.offset] == quote {
+				s.offset++
+			}
+			return
+		}
+		s.offset++
+	}
+}
+
+// skipSpace skips whitespace and comments, and line breaks when newlines is set
+func (s *tomlScanner) skipSpace(newlines bool) {
+	for s.offset < len(s.data) {
+		switch s.data[s.offset] {
+		case ' ', '\t', '\r':
+			s.offset++
+		case '\n':
+			if !newlines {
+				return
+			}
+			s.offset++
+		case '#':
+			s.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine skips to the end of the line
+func (s *tomlScanner) skipLine() {
+	for s.offset < len(s.data) && s.data[s.offset] != '\n' {
+		s.offset++
+	}
+}
+
+// joinKeys builds the path of a field of an object by a dotted key
+func joinKeys(path string, keys []string) string {
+	for _, key := range keys {
+		path = joinKey(path, key)
+	}
+	return path
+}
+
+// joinKey builds the path of a field of an object, e.g. "conditions[0].all"
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// offsetPosition converts a byte offset to a line and a column
+func offsetPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// locateInvalid returns the path of the innermost condition set, rule or top-level field of
+// a document that cannot be decoded, or an empty path when it cannot be told
+func locateInvalid(value interface{}) string {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	if conditions, ok := obj["conditions"].([]interface{}); ok {
+		for i, conditionSet := range conditions {
+			if !decodes(conditionSet, &ConditionSet{}) {
+				return locateInvalidRule(conditionSet, fmt.Sprintf("conditions[%d]", i))
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !decodes(map[string]interface{}{key: obj[key]}, &RuleSet{}) {
+			return key
+		}
+	}
+	return ""
+}
+
+// locateInvalidRule returns the path of the innermost nested rule that cannot be decoded,
+// the path of the rule itself when its nested rules can
+func locateInvalidRule(value interface{}, path string) string {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return path
+	}
+	for _, group := range []string{"all", "any", "none"} {
+		rules, _ := obj[group].([]interface{})
+		for i, rule := range rules {
+			if !decodes(rule, &Rule{}) {
+				return locateInvalidRule(rule, childPath(path, group, i))
+			}
+		}
+	}
+	if not, exists := obj["not"]; exists && !decodes(not, &Rule{}) {
+		return locateInvalidRule(not, path+".not")
+	}
+	return path
+}
+
+// decodes reports whether a JSON value can be decoded into target
+func decodes(value, target interface{}) bool {
+	data, err := json.Marshal(value)
+	return err == nil && json.Unmarshal(data, target) == nil
+}
@@ -0,0 +1,189 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var formatDocuments = map[Format]string{
+	FormatJSON: `{
+  "conditions": [
+    {
+      "all": [
+        {"field": "country", "operator": "in", "value": ["Turkey", "Germany"]},
+        {"field": "population", "operator": "greaterThan", "value": 1000}
+      ],
+      "not": {"field": "city", "operator": "equals", "value": "Ankara"}
+    }
+  ],
+  "event": {"type": "discount", "params": {"percent": 10}},
+  "score": 2.5
+}`,
+	FormatYAML: `conditions:
+  - all:
+      - field: country
+        operator: in
+        value: [Turkey, Germany]
+      - field: population
+        operator: greaterThan
+        value: 1000
+    not:
+      field: city
+      operator: equals
+      value: Ankara
+event:
+  type: discount
+  params:
+    percent: 10
+score: 2.5
+`,
+	FormatTOML: `score = 2.5
+
+[[conditions]]
+  [[conditions.all]]
+    field = "country"
+    operator = "in"
+    value = ["Turkey", "Germany"]
+  [[conditions.all]]
+    field = "population"
+    operator = "greaterThan"
+    value = 1000
+  [conditions.not]
+    field = "city"
+    operator = "equals"
+    value = "Ankara"
+
+[event]
+  type = "discount"
+  [event.params]
+    percent = 10
+`,
+}
+
+func TestParseRuleSet(t *testing.T) {
+	expected, err := ParseRuleSet([]byte(formatDocuments[FormatJSON]), FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for format, document := range formatDocuments {
+		ruleSet, err := ParseRuleSet([]byte(document), format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !reflect.DeepEqual(ruleSet, expected) {
+			t.Errorf("%s: ParseRuleSet() = %+v; expected %+v", format, ruleSet, expected)
+		}
+
+		program, err := CompileDocument([]byte(document), format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		result, err := program.Run(`{"country":"Turkey","population":2000,"city":"Istanbul"}`)
+		if err != nil || !result.Passed || len(result.Actions) != 1 {
+			t.Errorf("%s: Run() = %+v, %v; expected the discount", format, result, err)
+		}
+
+		// a rule set survives a round trip through every format
+		for _, target := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+			data, err := MarshalRuleSet(ruleSet, target)
+			if err != nil {
+				t.Fatalf("%s to %s: unexpected error: %v", format, target, err)
+			}
+			back, err := ParseRuleSet(data, target)
+			if err != nil {
+				t.Fatalf("%s to %s: unexpected error: %v\n%s", format, target, err, data)
+			}
+			if !reflect.DeepEqual(back, expected) {
+				t.Errorf("%s to %s: round trip = %+v; expected %+v\n%s", format, target, back, expected, data)
+			}
+		}
+	}
+}
+
+func TestParseRuleSetErrors(t *testing.T) {
+	tests := []struct {
+		format   Format
+		document string
+		line     int
+		column   int
+		path     string
+		err      error
+	}{
+		{FormatJSON, "{\"conditions\": [\n}", 2, 1, "", ErrInvalidRules},
+		{FormatJSON, "{\"conditions\": [\n  {\"all\": [\n    {\"field\": \"country\", \"operator\": \"eq\", \"value\": 1}\n  ]}\n]}", 3, 5, "conditions[0].all[0]", ErrUnknownOperator},
+		{FormatJSON, "{\"conditions\": [\n  {\"all\": [\n    {\"field\": [\"country\"]}\n  ]}\n]}", 3, 5, "conditions[0].all[0]", ErrInvalidRules},
+		{FormatYAML, "conditions:\n  - all: [\n", 2, 0, "", ErrInvalidRules},
+		{FormatYAML, "conditions:\n  - all:\n      - field: country\n        operator: in\n        value: Turkey\n", 3, 9, "conditions[0].all[0]", ErrInvalidRules},
+		{FormatYAML, "conditions:\n  - not:\n      any:\n        - field: [country]\n", 4, 11, "conditions[0].not.any[0]", ErrInvalidRules},
+		{FormatYAML, "conditions:\n  - all: []\nscore: high\n", 3, 8, "score", ErrInvalidRules},
+		{FormatTOML, "[[conditions]]\nall = [\n", 2, 8, "", ErrInvalidRules},
+		{FormatTOML, "[[conditions]]\n  [[conditions.all]]\n    field = \"country\"\n    operator = \"eq\"\n", 2, 3, "conditions[0].all[0]", ErrUnknownOperator},
+		{FormatTOML, "[[conditions]]\n  [[conditions.all]]\n    field = [\"country\"]\n", 2, 3, "conditions[0].all[0]", ErrInvalidRules},
+		{FormatTOML, "[[conditions]]\nall = [\n  {field = \"a\", operator = \"equals\", value = 1}, # first\n  {field = \"b\", operator = \"eq\", value = \"x]\"},\n]\n", 4, 3, "conditions[0].all[1]", ErrUnknownOperator},
+		{FormatTOML, "score = \"high\"\n[[conditions]]\n", 1, 9, "score", ErrInvalidRules},
+		{FormatTOML, "[[conditions]]\n[[conditions]]\n[conditions.not]\nfield = \"a\"\noperator = \"eq\"\n", 3, 1, "conditions[1].not", ErrUnknownOperator},
+		{Format("xml"), "<conditions/>", 0, 0, "", ErrInvalidRules},
+	}
+
+	for _, test := range tests {
+		_, err := CompileDocument([]byte(test.document), test.format)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s %q: error = %v; expected %v", test.format, test.document, err, test.err)
+			continue
+		}
+		var sourceErr *SourceError
+		if !errors.As(err, &sourceErr) {
+			if test.format == FormatJSON || test.format == FormatYAML || test.format == FormatTOML {
+				t.Errorf("%s %q: error = %v; expected a SourceError", test.format, test.document, err)
+			}
+			continue
+		}
+		if sourceErr.Line != test.line || sourceErr.Column != test.column || sourceErr.Path != test.path {
+			t.Errorf("%s %q: error at %d:%d %q; expected %d:%d %q", test.format, test.document, sourceErr.Line, sourceErr.Column, sourceErr.Path, test.line, test.column, test.path)
+		}
+	}
+}
+
+func TestParseRuleSetYAMLScalars(t *testing.T) {
+	// scalars JSON has no syntax for keep their text, as in the JSON document with the same text
+	document := `conditions:
+  - all:
+      - {field: date, operator: equals, value: 2024-01-01}
+      - {field: mode, operator: equals, value: 0755}
+      - {field: count, operator: equals, value: 1e3}
+      - {field: flag, operator: equals, value: true}
+      - <<: {field: base, operator: equals}
+        value: ~
+`
+	ruleSet, err := ParseRuleSet([]byte(document), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{"2024-01-01", "0755", 1000.0, true, nil}
+	for i, rule := range ruleSet.Conditions[0].All {
+		if !reflect.DeepEqual(rule.Value, expected[i]) {
+			t.Errorf("value %d = %#v; expected %#v", i, rule.Value, expected[i])
+		}
+	}
+	if merged := ruleSet.Conditions[0].All[4]; merged.Field != "base" || merged.Operator != "equals" {
+		t.Errorf("rule = %+v; expected the merged keys", merged)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"rules/discount.json": FormatJSON,
+		"rules/discount.yaml": FormatYAML,
+		"rules/discount.YML":  FormatYAML,
+		"rules/discount.toml": FormatTOML,
+		"rules/discount.xml":  "",
+	}
+	for path, expected := range tests {
+		format, err := FormatOf(path)
+		if format != expected || (err != nil) != (expected == "") {
+			t.Errorf("FormatOf(%q) = %q, %v; expected %q", path, format, err, expected)
+		}
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/nurettintopal/rule
 
 go 1.22.2
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
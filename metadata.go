@@ -0,0 +1,68 @@
+package rule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metadata describes a rule set or a rule. Only the effective window changes how they are
+// evaluated: outside of it a rule set does not match and a rule is skipped.
+type Metadata struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// EffectiveFrom and EffectiveUntil bound the time the rule set or rule is evaluated in,
+	// EffectiveFrom is included and EffectiveUntil is not. A nil bound leaves the window open.
+	EffectiveFrom  *time.Time `json:"effectiveFrom,omitempty"`
+	EffectiveUntil *time.Time `json:"effectiveUntil,omitempty"`
+}
+
+// EffectiveAt reports whether t is in the effective window
+func (m Metadata) EffectiveAt(t time.Time) bool {
+	return (m.EffectiveFrom == nil || !t.Before(*m.EffectiveFrom)) && (m.EffectiveUntil == nil || t.Before(*m.EffectiveUntil))
+}
+
+// hasWindow reports whether the effective window is bounded
+func (m Metadata) hasWindow() bool {
+	return m.EffectiveFrom != nil || m.EffectiveUntil != nil
+}
+
+// isZero reports whether no metadata is set
+func (m Metadata) isZero() bool {
+	return m.ID == "" && m.Name == "" && m.Description == "" && m.Owner == "" && m.Version == "" && len(m.Tags) == 0 && !m.hasWindow()
+}
+
+// checkWindow checks the effective window is not empty
+func (m Metadata) checkWindow() error {
+	if m.EffectiveFrom != nil && m.EffectiveUntil != nil && !m.EffectiveFrom.Before(*m.EffectiveUntil) {
+		return fmt.Errorf("%w: effectiveFrom %s is not before effectiveUntil %s", ErrInvalidRules,
+			m.EffectiveFrom.Format(time.RFC3339), m.EffectiveUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// anyRule reports whether fn is true for any of the rules, or of their nested rules
+func anyRule(rules []Rule, fn func(Rule) bool) bool {
+	for _, rule := range rules {
+		if fn(rule) || anyRule(rule.All, fn) || anyRule(rule.Any, fn) || anyRule(rule.None, fn) {
+			return true
+		}
+		if rule.Not != nil && anyRule([]Rule{*rule.Not}, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionRules returns the rules of a condition set
+func conditionRules(conditionSet ConditionSet) []Rule {
+	rules := append(append(append([]Rule{}, conditionSet.All...), conditionSet.Any...), conditionSet.None...)
+	if conditionSet.Not != nil {
+		rules = append(rules, *conditionSet.Not)
+	}
+	return rules
+}
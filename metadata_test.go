@@ -0,0 +1,147 @@
+package rule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetadata(t *testing.T) {
+	documents := map[Format]string{
+		FormatJSON: `{"id": "gold", "version": "3", "owner": "pricing", "tags": ["fee"], "effectiveFrom": "2024-01-01T00:00:00Z",
+			"conditions": [{"all": [{"field": "tier", "operator": "equals", "value": "gold", "id": "tier", "effectiveUntil": "2024-06-01T00:00:00Z"}]}]}`,
+		FormatYAML: `
+id: gold
+version: "3"
+owner: pricing
+tags: [fee]
+effectiveFrom: 2024-01-01T00:00:00Z
+conditions:
+  - all:
+      - {field: tier, operator: equals, value: gold, id: tier, effectiveUntil: 2024-06-01T00:00:00Z}
+`,
+		FormatTOML: `
+id = "gold"
+version = "3"
+owner = "pricing"
+tags = ["fee"]
+effectiveFrom = 2024-01-01T00:00:00Z
+
+[[conditions]]
+[[conditions.all]]
+field = "tier"
+operator = "equals"
+value = "gold"
+id = "tier"
+effectiveUntil = 2024-06-01T00:00:00Z
+`,
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for format, document := range documents {
+		ruleSet, err := ParseRuleSet([]byte(document), format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", format, err)
+			continue
+		}
+		if ruleSet.ID != "gold" || ruleSet.Version != "3" || ruleSet.Owner != "pricing" || len(ruleSet.Tags) != 1 || !ruleSet.EffectiveFrom.Equal(from) {
+			t.Errorf("%s: metadata = %+v", format, ruleSet.Metadata)
+		}
+		if rule := ruleSet.Conditions[0].All[0]; rule.ID != "tier" || !rule.EffectiveUntil.Equal(until) || rule.Field != "tier" {
+			t.Errorf("%s: rule = %+v", format, rule)
+		}
+	}
+
+	if _, err := MarshalRuleSet(RuleSet{Metadata: Metadata{Version: "3"}}, FormatExpression); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for metadata in an expression; got %v", err)
+	}
+}
+
+func TestEffectiveWindow(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rules := `{
+		"version": "2",
+		"effectiveFrom": "2024-02-01T00:00:00Z",
+		"effectiveUntil": "2024-04-01T00:00:00Z",
+		"conditions": [{
+			"all": [
+				{"field": "total", "operator": "greaterThan", "value": 100},
+				{"field": "total", "operator": "greaterThan", "value": 1000, "effectiveFrom": "2024-03-15T00:00:00Z"}
+			],
+			"any": [{"field": "tier", "operator": "equals", "value": "gold", "effectiveUntil": "2024-03-01T00:00:00Z"}],
+			"not": {"field": "tier", "operator": "equals", "value": "silver", "effectiveUntil": "2024-02-15T00:00:00Z"}
+		}],
+		"onFailure": {"type": "reject"}
+	}`
+	program, err := Compile(rules, WithClock(clock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := `{"total": 500, "tier": "silver"}`
+	if passed, err := program.Eval(input); err != nil || !passed {
+		t.Errorf("Eval() = %v, %v; expected the rules outside their window to be left out", passed, err)
+	}
+	trace, err := program.Explain(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all := trace.Children[0].Children[0]
+	if all.Children[0].Inactive || !all.Children[1].Inactive || !all.Children[1].Skipped || !all.Result {
+		t.Errorf("trace = %s; expected the second rule to be inactive", trace)
+	}
+	if !strings.Contains(trace.String(), "PASS  rule set@2\n") || !strings.Contains(trace.String(), "(outside its effective window)") {
+		t.Errorf("trace = %s; expected the version and the inactive rules", trace)
+	}
+
+	now = time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	if passed, _ := program.Eval(input); passed {
+		t.Errorf("expected the rule that became effective to fail")
+	}
+
+	now = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	result, err := program.Run(`{"total": 5000}`)
+	if err != nil || result.Passed || !result.Skipped || len(result.Actions) != 0 {
+		t.Errorf("Run() = %+v, %v; expected the rule set to be skipped without firing actions", result, err)
+	}
+	if trace, _ := program.Explain(`{"total": 5000}`); !trace.Inactive || trace.Children[0].Inactive {
+		t.Errorf("trace = %+v; expected the rule set to be inactive", trace)
+	}
+}
+
+func TestEffectiveWindowEngine(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine(AllMatches, WithClock(func() time.Time { return now }))
+	engine.Add("current", 0, `{"version": "1", "effectiveUntil": "2024-03-15T00:00:00Z", "conditions": []}`)
+	engine.Add("next", 0, `{"version": "2", "effectiveFrom": "2024-03-15T00:00:00Z", "conditions": []}`)
+
+	matches, err := engine.Run(`{}`)
+	if err != nil || len(matches) != 1 || matches[0].ID != "current" || matches[0].Version != "1" {
+		t.Errorf("matches = %+v, %v; expected the current version", matches, err)
+	}
+	now = now.AddDate(0, 1, 0)
+	if matches, _ := engine.Run(`{}`); len(matches) != 1 || matches[0].ID != "next" || matches[0].Version != "2" {
+		t.Errorf("matches = %+v; expected the next version", matches)
+	}
+}
+
+func TestInvalidWindow(t *testing.T) {
+	rules := `{"conditions": [{"all": [{"field": "a", "operator": "equals", "value": 1,
+		"effectiveFrom": "2024-03-01T00:00:00Z", "effectiveUntil": "2024-02-01T00:00:00Z"}]}]}`
+	_, err := Compile(rules)
+	var ruleErr *RuleError
+	if !errors.Is(err, ErrInvalidRules) || !errors.As(err, &ruleErr) || ruleErr.Path != "conditions[0].all[0]" {
+		t.Errorf("expected an error locating the rule; got %v", err)
+	}
+
+	if _, err := Compile(`{"effectiveFrom": "2024-03-01T00:00:00Z", "effectiveUntil": "2024-03-01T00:00:00Z", "conditions": []}`); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for an empty window; got %v", err)
+	}
+
+	ruleSet, _ := ParseRuleSet([]byte(rules), FormatJSON)
+	if diagnostics := Validate(ruleSet); !diagnostics.HasErrors() || diagnostics[0].Path != "conditions[0].all[0]" {
+		t.Errorf("diagnostics = %v; expected the empty window", diagnostics)
+	}
+}
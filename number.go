@@ -0,0 +1,140 @@
+package rule
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// number is a numeric value normalised from any Go numeric type, a json.Number or a numeric string
+type number struct {
+	isInt bool
+	i     int64
+	f     float64
+}
+
+// toNumber normalises a numeric value, numeric strings are only accepted when allowStrings is set
+func toNumber(value interface{}, allowStrings bool) (number, bool) {
+	switch v := value.(type) {
+	case float64:
+		return floatNumber(v)
+	case int:
+		return number{isInt: true, i: int64(v)}, true
+	case int64:
+		return number{isInt: true, i: v}, true
+	case json.Number:
+		return parseNumber(string(v))
+	case string:
+		if !allowStrings {
+			return number{}, false
+		}
+		return parseNumber(v)
+	case float32:
+		// go through the shortest decimal form so float32(0.1) equals 0.1
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return floatNumber(f)
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{isInt: true, i: rv.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return number{isInt: true, i: int64(u)}, true
+		} else {
+			return number{f: float64(u)}, true
+		}
+	case reflect.Float32, reflect.Float64:
+		return floatNumber(rv.Float())
+	}
+	return number{}, false
+}
+
+func floatNumber(f float64) (number, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return number{}, false
+	}
+	return number{f: f}, true
+}
+
+// parseNumber parses the decimal representation of an integer or a float
+func parseNumber(s string) (number, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return number{isInt: true, i: i}, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return number{}, false
+	}
+	return floatNumber(f)
+}
+
+// float returns the number as a float64
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+// compare compares two numbers, integers are compared exactly
+func (n number) compare(other number) int {
+	if n.isInt && other.isInt {
+		return compareValues(n.i, other.i)
+	}
+	return compareValues(n.float(), other.float())
+}
+
+// numbers normalises two operands when both are numeric, numeric strings are only accepted
+// when strict is not set
+func numbers(a, b interface{}, strict bool) (number, number, bool) {
+	x, ok := toNumber(a, !strict)
+	if !ok {
+		return number{}, number{}, false
+	}
+	y, ok := toNumber(b, !strict)
+	return x, y, ok
+}
+
+// valuesEqual checks if two values are equal, numbers of different types and a number and a
+// numeric string are equal when they have the same value, arrays and objects are compared
+// element by element. Two strings are compared as text, so "007" does not equal "7".
+func valuesEqual(a, b interface{}) bool {
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if x, y, ok := numbers(a, b, false); ok && !(aIsString && bIsString) {
+		return x.compare(y) == 0
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isList(a) && isList(b):
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for i := 0; i < va.Len(); i++ {
+			if !valuesEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	case va.Kind() == reflect.Map && vb.Kind() == reflect.Map &&
+		va.Type().Key().Kind() == reflect.String && vb.Type().Key().Kind() == reflect.String:
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for _, key := range va.MapKeys() {
+			other := vb.MapIndex(reflect.ValueOf(key.String()).Convert(vb.Type().Key()))
+			if !other.IsValid() || !valuesEqual(va.MapIndex(key).Interface(), other.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,153 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEqualsOperatorWithNumbers(t *testing.T) {
+	values := []interface{}{20000, 20000.0, int64(20000), int32(20000), uint16(20000), float32(20000), json.Number("20000")}
+
+	op := EqualsOperator{}
+	for _, a := range values {
+		for _, b := range values {
+			if !op.Apply(a, b) {
+				t.Errorf("Expected %T(%v) equals %T(%v)", a, a, b, b)
+			}
+		}
+	}
+
+	if !op.Apply(20000, "20000") || !op.Apply("20000", 20000.0) {
+		t.Errorf("Expected 20000 equals \"20000\"")
+	}
+	if op.Apply(20000, "abc") || op.Apply("abc", 20000) {
+		t.Errorf("Expected 20000 not equals \"abc\"")
+	}
+	if !op.Apply(float32(0.1), 0.1) {
+		t.Errorf("Expected float32(0.1) equals 0.1")
+	}
+	if !op.Apply([]interface{}{1.0, "a"}, []interface{}{1, "a"}) {
+		t.Errorf("Expected [1.0, a] equals [1, a]")
+	}
+	if !op.Apply(map[string]interface{}{"a": 1.0}, map[string]int{"a": 1}) {
+		t.Errorf("Expected {a: 1.0} equals {a: 1}")
+	}
+
+	strict := EqualsOperator{Strict: true}
+	if strict.Apply(20000, 20000.0) {
+		t.Errorf("Expected 20000 not strictly equals 20000.0")
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	tests := []struct {
+		a, b     interface{}
+		expected int
+	}{
+		{20000, 19999.5, 1},
+		{int64(20000), 20000.0, 0},
+		{json.Number("20000"), 30000, -1},
+		{"20000", 3000, 1},
+		{"20000", 20000, 0},
+		{"10", "9", 1},
+		{"abc", "abd", -1},
+		{uint64(18446744073709551615), int64(1), 1},
+		{int64(9007199254740993), int64(9007199254740992), 1},
+	}
+
+	for _, test := range tests {
+		result, err := compare(test.a, test.b, false)
+		if err != nil {
+			t.Errorf("compare(%v, %v) unexpected error: %v", test.a, test.b, err)
+		}
+		if result != test.expected {
+			t.Errorf("compare(%v, %v) = %d; expected %d", test.a, test.b, result, test.expected)
+		}
+		// equality agrees with ordering
+		if equal := (EqualsOperator{}).Apply(test.a, test.b); equal != (test.expected == 0) {
+			t.Errorf("equals(%v, %v) = %v; expected %v", test.a, test.b, equal, test.expected == 0)
+		}
+	}
+
+	for _, test := range []struct{ a, b interface{} }{{20000, 20000.0}, {"20000", 20000.0}, {json.Number("1"), 1.0}} {
+		if _, err := compare(test.a, test.b, true); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("strict compare(%v, %v) error = %v; expected %v", test.a, test.b, err, ErrTypeMismatch)
+		}
+	}
+}
+
+func TestEqualsStrings(t *testing.T) {
+	// two strings are compared as text, identifiers with leading zeros stay distinct
+	tests := []struct {
+		input, operator, value string
+		expected               bool
+	}{
+		{`"007"`, "equals", `"7"`, false},
+		{`"1e3"`, "in", `["1000"]`, false},
+		{`"0.10"`, "notEquals", `"0.1"`, true},
+		{`"0.10"`, "notIn", `["0.1"]`, true},
+		{`"007"`, "equals", `7`, true},
+		{`7`, "in", `["007"]`, true},
+	}
+	for _, test := range tests {
+		rules := `{"conditions":[{"all":[{"field":"id","operator":"` + test.operator + `","value":` + test.value + `}]}]}`
+		if result := Execute(`{"id":`+test.input+`}`, rules, nil); result != test.expected {
+			t.Errorf("%s %s %s = %v; expected %v", test.input, test.operator, test.value, result, test.expected)
+		}
+	}
+}
+
+func TestEvaluateWithMixedNumbers(t *testing.T) {
+	input := map[string]interface{}{
+		"population": int64(20000),
+		"rate":       float32(4.5),
+		"count":      json.Number("12"),
+	}
+
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"population",
+				   "operator":"equals",
+				   "value":20000
+				},
+				{
+				   "field":"population",
+				   "operator":"greaterThan",
+				   "value":19000.5
+				},
+				{
+				   "field":"rate",
+				   "operator":"lessThanInclusive",
+				   "value":4.5
+				},
+				{
+				   "field":"count",
+				   "operator":"in",
+				   "value":[10, 12]
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	result, err := Evaluate(input, rules, nil)
+	if err != nil || !result {
+		t.Errorf("Evaluate = %v, %v; expected true", result, err)
+	}
+
+	program, err := Compile(rules, WithStrictTypes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err = program.Eval(input)
+	if result {
+		t.Errorf("it is passed")
+	}
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package rule
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentKind tells how a path segment selects values
+type segmentKind int
+
+const (
+	segmentKey segmentKind = iota
+	segmentIndex
+	segmentWildcard
+)
+
+// pathSegment is a single step of a field path
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// fieldPath is a parsed Rule.Field such as "customer.address.country", "items[0].sku"
+// or "items[*].price". Dots inside keys are escaped with a backslash, e.g. "a\.b".
+type fieldPath struct {
+	raw      string
+	segments []pathSegment
+	// wildcard is set when the path selects many values
+	wildcard bool
+}
+
+// parseFieldPath parses the path syntax of Rule.Field
+func parseFieldPath(field string) (fieldPath, error) {
+	p := fieldPath{raw: field}
+	var key strings.Builder
+	pendingKey := true
+
+	endKey := func(i int) error {
+		if key.Len() == 0 {
+			if pendingKey {
+				return fmt.Errorf("%w: empty key at position %d of field path %q", ErrInvalidRules, i, field)
+			}
+			return nil
+		}
+		p.segments = append(p.segments, pathSegment{kind: segmentKey, key: key.String()})
+		key.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(field); i++ {
+		switch c := field[i]; c {
+		case '\\':
+			if i+1 == len(field) {
+				return p, fmt.Errorf("%w: trailing escape in field path %q", ErrInvalidRules, field)
+			}
+			i++
+			key.WriteByte(field[i])
+			pendingKey = false
+		case '.':
+			if err := endKey(i); err != nil {
+				return p, err
+			}
+			pendingKey = true
+		case '[':
+			if key.Len() > 0 {
+				if err := endKey(i); err != nil {
+					return p, err
+				}
+			} else if pendingKey && i > 0 {
+				return p, fmt.Errorf("%w: empty key at position %d of field path %q", ErrInvalidRules, i, field)
+			}
+			end := strings.IndexByte(field[i:], ']')
+			if end < 0 {
+				return p, fmt.Errorf("%w: unclosed bracket at position %d of field path %q", ErrInvalidRules, i, field)
+			}
+			inner := field[i+1 : i+end]
+			if inner == "*" {
+				p.segments = append(p.segments, pathSegment{kind: segmentWildcard})
+				p.wildcard = true
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return p, fmt.Errorf("%w: invalid index %q in field path %q", ErrInvalidRules, inner, field)
+				}
+				p.segments = append(p.segments, pathSegment{kind: segmentIndex, index: index})
+			}
+			i += end
+			pendingKey = false
+		default:
+			key.WriteByte(c)
+			pendingKey = false
+		}
+	}
+	if err := endKey(len(field)); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// resolve finds the values selected by the path. A path without wildcards selects
+// exactly one value. A wildcard path selects every value it reaches, elements missing
+// the rest of the path are skipped, so the selection can be empty: of an empty array, or
+// when no element has the rest of the path.
+func (p fieldPath) resolve(obj interface{}) ([]interface{}, bool) {
+	// a top level key matching the whole field wins, so keys containing dots keep working
+	if data, isMap := obj.(map[string]interface{}); isMap {
+		if value, exists := data[p.raw]; exists {
+			return []interface{}{value}, true
+		}
+	} else if len(p.segments) != 1 || p.segments[0].kind != segmentKey || p.segments[0].key != p.raw {
+		if values := selectPath(obj, pathSegment{kind: segmentKey, key: p.raw}); len(values) > 0 {
+			return values, true
+		}
+	}
+
+	var values []interface{}
+	afterWildcard := false
+	for i, segment := range p.segments {
+		var next []interface{}
+		if i == 0 {
+			next = selectPath(obj, segment)
+		} else if len(values) == 1 {
+			next = selectPath(values[0], segment)
+		} else {
+			for _, value := range values {
+				next = append(next, selectPath(value, segment)...)
+			}
+		}
+		if segment.kind == segmentWildcard {
+			// a wildcard over an empty collection selects nothing, anything else is missing
+			if len(next) == 0 && !afterWildcard && !collections(obj, values, i) {
+				return nil, false
+			}
+			afterWildcard = true
+		} else if len(next) == 0 && !afterWildcard {
+			return nil, false
+		}
+		values = next
+	}
+	return values, true
+}
+
+// collections reports whether the values a segment is applied to, obj for the first one,
+// are maps, slices or arrays
+func collections(obj interface{}, values []interface{}, segment int) bool {
+	if segment == 0 {
+		values = []interface{}{obj}
+	}
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return false
+			}
+			v = v.Elem()
+		}
+		if kind := v.Kind(); kind != reflect.Map && kind != reflect.Slice && kind != reflect.Array {
+			return false
+		}
+	}
+	return true
+}
+
+// selectPath applies a single path segment to a value
+func selectPath(value interface{}, segment pathSegment) []interface{} {
+	switch data := value.(type) {
+	case map[string]interface{}:
+		switch segment.kind {
+		case segmentKey:
+			if child, exists := data[segment.key]; exists {
+				return []interface{}{child}
+			}
+			return nil
+		case segmentWildcard:
+			keys := make([]string, 0, len(data))
+			for key := range data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			children := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				children = append(children, data[key])
+			}
+			return children
+		}
+		return nil
+	case []interface{}:
+		switch segment.kind {
+		case segmentIndex:
+			if segment.index < len(data) {
+				return []interface{}{data[segment.index]}
+			}
+			return nil
+		case segmentWildcard:
+			return data
+		}
+		return nil
+	case FieldAccessor:
+		if segment.kind == segmentKey {
+			if child, exists := data.RuleField(segment.key); exists {
+				return []interface{}{inputValue(child)}
+			}
+			return nil
+		}
+	}
+	return selectReflect(reflect.ValueOf(value), segment)
+}
+
+// selectReflect applies a path segment to structs, pointers to them, and maps and slices
+// of other types
+func selectReflect(value reflect.Value, segment pathSegment) []interface{} {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		return selectStruct(value, segment)
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		switch segment.kind {
+		case segmentKey:
+			child := value.MapIndex(reflect.ValueOf(segment.key).Convert(value.Type().Key()))
+			if !child.IsValid() {
+				return nil
+			}
+			return []interface{}{reflectValue(child)}
+		case segmentWildcard:
+			keys := value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			children := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				children = append(children, reflectValue(value.MapIndex(key)))
+			}
+			return children
+		}
+	case reflect.Slice, reflect.Array:
+		switch segment.kind {
+		case segmentIndex:
+			if segment.index < value.Len() {
+				return []interface{}{reflectValue(value.Index(segment.index))}
+			}
+		case segmentWildcard:
+			children := make([]interface{}, 0, value.Len())
+			for i := 0; i < value.Len(); i++ {
+				children = append(children, reflectValue(value.Index(i)))
+			}
+			return children
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		field    string
+		segments []pathSegment
+		wildcard bool
+	}{
+		{"country", []pathSegment{{kind: segmentKey, key: "country"}}, false},
+		{"customer.address.country", []pathSegment{{kind: segmentKey, key: "customer"}, {kind: segmentKey, key: "address"}, {kind: segmentKey, key: "country"}}, false},
+		{"items[0].sku", []pathSegment{{kind: segmentKey, key: "items"}, {kind: segmentIndex, index: 0}, {kind: segmentKey, key: "sku"}}, false},
+		{"items[*].price", []pathSegment{{kind: segmentKey, key: "items"}, {kind: segmentWildcard}, {kind: segmentKey, key: "price"}}, true},
+		{"matrix[1][2]", []pathSegment{{kind: segmentKey, key: "matrix"}, {kind: segmentIndex, index: 1}, {kind: segmentIndex, index: 2}}, false},
+		{`labels.app\.kubernetes\.io`, []pathSegment{{kind: segmentKey, key: "labels"}, {kind: segmentKey, key: "app.kubernetes.io"}}, false},
+	}
+
+	for _, test := range tests {
+		path, err := parseFieldPath(test.field)
+		if err != nil {
+			t.Errorf("parseFieldPath(%s) unexpected error: %v", test.field, err)
+			continue
+		}
+		if !reflect.DeepEqual(path.segments, test.segments) || path.wildcard != test.wildcard {
+			t.Errorf("parseFieldPath(%s) = %+v; expected %+v", test.field, path.segments, test.segments)
+		}
+	}
+
+	for _, field := range []string{"", ".country", "country.", "a..b", "items[", "items[x]", "items[-1]", "items.[0]", `country\`} {
+		if _, err := parseFieldPath(field); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("parseFieldPath(%s) error = %v; expected %v", field, err, ErrInvalidRules)
+		}
+	}
+}
+
+func TestEvaluateWithFieldPaths(t *testing.T) {
+	input := `{
+		"customer": {"address": {"country": "Turkey"}},
+		"items": [
+			{"sku": "A-1", "price": 10},
+			{"sku": "B-2", "price": 250},
+			{"sku": "C-3"}
+		],
+		"tags": ["new", "vip"],
+		"empty": [],
+		"a.b": "dotted",
+		"labels": {"app.kubernetes.io": "rule"}
+	}`
+
+	tests := []struct {
+		field    string
+		operator string
+		value    string
+		expected bool
+	}{
+		{"customer.address.country", "equals", `"Turkey"`, true},
+		{"items[0].sku", "equals", `"A-1"`, true},
+		{"items[1].sku", "startsWith", `"B"`, true},
+		{"items[*].price", "greaterThan", `100`, true},
+		{"items[*].price", "greaterThan", `1000`, false},
+		{"items[*].sku", "notEquals", `"D-4"`, true},
+		{"items[*].sku", "notEquals", `"A-1"`, false},
+		{"tags[*]", "in", `["vip"]`, true},
+		{"tags[*]", "notIn", `["vip"]`, false},
+		// empty selections pass the negated operators only
+		{"empty[*]", "in", `["vip"]`, false},
+		{"empty[*]", "notIn", `["vip"]`, true},
+		{"items[*].weight", "equals", `1`, false},
+		{"items[*].weight", "notIn", `[1]`, true},
+		{"a.b", "equals", `"dotted"`, true},
+		{`labels.app\\.kubernetes\\.io`, "equals", `"rule"`, true},
+	}
+
+	for _, test := range tests {
+		rules := `{"conditions":[{"all":[{"field":"` + test.field + `","operator":"` + test.operator + `","value":` + test.value + `}]}]}`
+		result, err := Evaluate(input, rules, nil)
+		if err != nil {
+			t.Errorf("%s %s %s: unexpected error: %v", test.field, test.operator, test.value, err)
+		}
+		if result != test.expected {
+			t.Errorf("%s %s %s = %v; expected %v", test.field, test.operator, test.value, result, test.expected)
+		}
+	}
+
+	for _, field := range []string{"customer.address.city", "items[5].sku", "tags[0].name", "tags[0][*]", "missing[*].price"} {
+		rules := `{"conditions":[{"all":[{"field":"` + field + `","operator":"equals","value":1}]}]}`
+		if _, err := Evaluate(input, rules, nil); !errors.Is(err, ErrMissingField) {
+			t.Errorf("%s: error = %v; expected %v", field, err, ErrMissingField)
+		}
+	}
+}
+
+func TestResolveFieldPathWithTypedValues(t *testing.T) {
+	obj := map[string]interface{}{
+		"tags":   []string{"new", "vip"},
+		"limits": map[string]int{"daily": 100},
+	}
+
+	tests := []struct {
+		field    string
+		expected []interface{}
+	}{
+		{"tags[1]", []interface{}{"vip"}},
+		{"tags[*]", []interface{}{"new", "vip"}},
+		{"limits.daily", []interface{}{100}},
+	}
+
+	for _, test := range tests {
+		path, _ := parseFieldPath(test.field)
+		values, exists := path.resolve(obj)
+		if !exists || !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("resolve(%s) = %v, %v; expected %v", test.field, values, exists, test.expected)
+		}
+	}
+}
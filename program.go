@@ -0,0 +1,762 @@
+package rule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures how rules are compiled
+type Option func(*options)
+
+type options struct {
+	custom map[string]CustomOperation
+	// strict rejects comparisons between values of different types
+	strict bool
+	// clock returns the evaluation time of date and time operators
+	clock func() time.Time
+	// registry resolves operator names, the built-in operators are used when it is nil
+	registry *Registry
+	// schema checks the fields and values of the rules
+	schema *Schema
+	// parallelism bounds the goroutines evaluating condition sets and rules, 1 or less is sequential
+	parallelism int
+	// lenient compiles broken rules into rules that never pass instead of failing,
+	// it keeps the behaviour of Execute
+	lenient bool
+}
+
+// WithCustom injects the custom operators and custom inputs used by the rules
+func WithCustom(custom map[string]CustomOperation) Option {
+	return func(o *options) {
+		o.custom = custom
+	}
+}
+
+// WithStrictTypes makes equality, ordering and membership operators reject
+// comparisons between different types, e.g. an int field against a float64 value
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithClock sets the source of the current time used by date and time operators, it
+// makes evaluations deterministic in tests
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithRegistry resolves the operators of the rules from the registry instead of the built-in operators
+func WithRegistry(registry *Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithParallelism evaluates condition sets and the rules of a group concurrently, using at most
+// n goroutines per evaluation. It pays off when custom operations do I/O, rules are cheap
+// enough to be evaluated sequentially otherwise. The result is the one of a sequential
+// evaluation, but rules after the one deciding a group may be evaluated too.
+func WithParallelism(n int) Option {
+	return func(o *options) {
+		o.parallelism = n
+	}
+}
+
+func withLenient() Option {
+	return func(o *options) {
+		o.lenient = true
+	}
+}
+
+// Program is a compiled RuleSet, it can be evaluated many times from many goroutines
+type Program struct {
+	ruleSet     RuleSet
+	conditions  []node
+	lenient     bool
+	parallelism int
+	// windowed is set when the rule set or any of its rules has an effective window
+	windowed bool
+	// clock returns the time effective windows are checked against
+	clock func() time.Time
+}
+
+// node is a compiled rule or a compiled group of rules
+type node interface {
+	// eval checks the node, filling in its trace when t is not nil
+	eval(e *evaluation, t *Trace) (bool, error)
+	// trace returns the trace of the node before it is evaluated
+	trace() *Trace
+}
+
+// evaluation holds the state of a single evaluation of a Program
+type evaluation struct {
+	ctx     context.Context
+	program *Program
+	// obj is the input, a map, a struct or a FieldAccessor
+	obj interface{}
+	// slots holds a token for every goroutine that may be started, it is nil when sequential
+	slots chan struct{}
+	// now is the time effective windows are checked against, it is only set for windowed programs
+	now time.Time
+	// score collects the weights of the passing rules of a rule set in scoring mode, it is nil otherwise
+	score *scoreSheet
+}
+
+// compiledGroup is a ConditionSet, or a Rule grouping nested rules, whose rules have been compiled
+type compiledGroup struct {
+	kind string
+	path string
+	all  []node
+	any  []node
+	none []node
+	not  node
+	// metadata is the metadata of a Rule grouping nested rules
+	metadata Metadata
+	// weight is the weight of the condition set, or of the Rule grouping nested rules
+	weight float64
+}
+
+// compiledRule is a Rule whose operator and custom operations have been resolved
+type compiledRule struct {
+	rule Rule
+	path string
+	// err is set when the rule could not be compiled
+	err error
+	// external resolves the field value for "external." fields
+	external CustomOperation
+	// custom replaces the operator for "custom." operators
+	custom   CustomOperation
+	operator Operator
+	// field is the parsed Rule.Field of rules that are not "external."
+	field fieldPath
+	// every makes a wildcard field pass only when all of its values pass
+	every bool
+	// fieldTypes lists the field value types the operator accepts
+	fieldTypes []Type
+}
+
+// Compile parses the rules and resolves every operator and custom operation once
+func Compile(rules string, opts ...Option) (*Program, error) {
+	var ruleSet RuleSet
+	if err := json.Unmarshal([]byte(rules), &ruleSet); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+	return CompileRuleSet(ruleSet, opts...)
+}
+
+// CompileRuleSet resolves every operator and custom operation of the rule set once
+func CompileRuleSet(ruleSet RuleSet, opts ...Option) (*Program, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := ruleSet.checkWindow(); err != nil {
+		return nil, err
+	}
+
+	p := &Program{ruleSet: ruleSet, lenient: o.lenient, parallelism: o.parallelism, clock: o.clock}
+	p.windowed = ruleSet.hasWindow()
+	for _, conditionSet := range ruleSet.Conditions {
+		p.windowed = p.windowed || anyRule(conditionRules(conditionSet), Rule.hasWindow)
+	}
+	for i, conditionSet := range ruleSet.Conditions {
+		group, err := compileGroup(TraceConditionSet, conditionSet.All, conditionSet.Any, conditionSet.None, conditionSet.Not, fmt.Sprintf("conditions[%d]", i), &o)
+		if err != nil && !o.lenient {
+			return nil, err
+		}
+		group.weight = conditionSet.Weight
+		p.conditions = append(p.conditions, group)
+	}
+	return p, nil
+}
+
+// compileGroup compiles the nested rules of a group and returns the first error found in them
+func compileGroup(kind string, all, any, none []Rule, not *Rule, path string, o *options) (*compiledGroup, error) {
+	var firstErr error
+	compileNodes := func(rules []Rule, group string) []node {
+		nodes := make([]node, 0, len(rules))
+		for i, rule := range rules {
+			n, err := compileNode(rule, childPath(path, group, i), o)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			nodes = append(nodes, n)
+		}
+		return nodes
+	}
+
+	g := &compiledGroup{
+		kind: kind,
+		path: path,
+		all:  compileNodes(all, "all"),
+		any:  compileNodes(any, "any"),
+		none: compileNodes(none, "none"),
+	}
+	if not != nil {
+		n, err := compileNode(*not, path+".not", o)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		g.not = n
+	}
+	return g, firstErr
+}
+
+// compileNode compiles a rule, or the nested rules of a group
+func compileNode(rule Rule, path string, o *options) (node, error) {
+	if err := rule.checkWindow(); err != nil {
+		r := &compiledRule{rule: rule, path: path}
+		r.err = r.fail(err)
+		return r, r.err
+	}
+	if rule.IsGroup() {
+		g, err := compileGroup(TraceGroup, rule.All, rule.Any, rule.None, rule.Not, path, o)
+		g.metadata, g.weight = rule.Metadata, rule.Weight
+		return g, err
+	}
+	r := compileRule(rule, path, o)
+	return r, r.err
+}
+
+// RuleSet returns the rule set the program was compiled from
+func (p *Program) RuleSet() RuleSet {
+	return p.ruleSet
+}
+
+// Eval evaluates the program against a JSON string or a map
+func (p *Program) Eval(input interface{}) (bool, error) {
+	return p.EvalContext(context.Background(), input)
+}
+
+// EvalContext evaluates the program like Eval does, the evaluation stops with the error of
+// the context once it is cancelled or its deadline is exceeded
+func (p *Program) EvalContext(ctx context.Context, input interface{}) (bool, error) {
+	e, err := p.evaluation(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	return p.eval(e, nil)
+}
+
+// evaluation starts an evaluation of the program against the input
+func (p *Program) evaluation(ctx context.Context, input interface{}) (*evaluation, error) {
+	obj, err := parseInput(input)
+	if err != nil {
+		return nil, err
+	}
+	e := &evaluation{ctx: ctx, program: p, obj: obj}
+	if p.parallelism > 1 {
+		e.slots = make(chan struct{}, p.parallelism-1)
+	}
+	if p.windowed {
+		e.now = p.now()
+	}
+	if p.ruleSet.Scoring != nil {
+		// the contributions are collected in order, so a scored evaluation is sequential
+		e.score, e.slots = &scoreSheet{}, nil
+	}
+	return e, nil
+}
+
+// now returns the time effective windows are checked against
+func (p *Program) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// Explain evaluates the program like Eval does and returns the trace of every
+// condition set and rule, rules skipped by short-circuiting are marked as such
+func (p *Program) Explain(input interface{}) (*Trace, error) {
+	return p.ExplainContext(context.Background(), input)
+}
+
+// ExplainContext explains the program like Explain does, stopping like EvalContext does.
+// It always evaluates sequentially so the skipped rules of the trace are the same every time.
+func (p *Program) ExplainContext(ctx context.Context, input interface{}) (*Trace, error) {
+	e, err := p.evaluation(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	e.slots = nil
+	t := p.trace()
+	_, err = p.eval(e, t)
+	return t, err
+}
+
+// eval checks every condition set, stopping at the first failure or error. A rule set
+// outside its effective window does not pass. A rule set in scoring mode evaluates every
+// condition set and rule, stopping at the first error only.
+func (p *Program) eval(e *evaluation, t *Trace) (bool, error) {
+	if p.windowed && !p.ruleSet.EffectiveAt(e.now) {
+		t.deactivate()
+		return false, nil
+	}
+	t.visit()
+	failed, err := e.evalNodes(p.conditions, t, failsAll)
+	if err != nil || (failed && e.score == nil) {
+		return false, t.fail(err)
+	}
+	if e.score != nil {
+		// in scoring mode the rule set passes when its score reaches the threshold, whether
+		// its conditions pass or not
+		t.setScore(e.score.total)
+		if e.score.total < p.ruleSet.Scoring.Threshold {
+			return false, t.fail(nil)
+		}
+	}
+	return t.pass(), nil
+}
+
+// eval checks the parts of a group in order, stopping at the first failure or error
+func (g *compiledGroup) eval(e *evaluation, t *Trace) (bool, error) {
+	t.visit()
+	passed := true
+	// settle records the outcome of a part and reports whether the group is decided, a
+	// failed part decides it unless the evaluation is scored, which evaluates every part
+	settle := func(part *Trace, failed bool, err error) bool {
+		if !failed {
+			part.pass()
+			return false
+		}
+		part.fail(err)
+		passed = false
+		return err != nil || e.score == nil
+	}
+
+	if len(g.all) > 0 {
+		all := t.part(TraceAll)
+		all.visit()
+		if failed, err := e.evalNodes(g.all, all, failsAll); settle(all, failed, err) {
+			return false, t.fail(err)
+		}
+	}
+
+	if len(g.any) > 0 {
+		anyPart := t.part(TraceAny)
+		anyPart.visit()
+		matched, err := e.evalNodes(g.any, anyPart, decidesAny)
+		// an "any" whose rules are all outside their effective window is left out, like an empty one
+		if err == nil && !matched && e.noneEffective(g.any) {
+			matched = true
+		}
+		if settle(anyPart, err != nil || !matched, err) {
+			return false, t.fail(err)
+		}
+	}
+
+	if len(g.none) > 0 {
+		none := t.part(TraceNone)
+		none.visit()
+		failed, err := e.negate(func() (bool, error) { return e.evalNodes(g.none, none, decidesAny) })
+		if settle(none, failed, err) {
+			return false, t.fail(err)
+		}
+	}
+
+	if g.not != nil {
+		not := t.part(TraceNot)
+		not.visit()
+		if !e.effective(g.not) {
+			// a "not" of a rule outside its effective window is left out
+			not.child(0).deactivate()
+			not.pass()
+		} else {
+			result, err := e.negate(func() (bool, error) { return g.not.eval(e, not.child(0)) })
+			if settle(not, err != nil || result, err) {
+				return false, t.fail(err)
+			}
+		}
+	}
+
+	e.addScore(passed, g.weight, g.path, g.metadata.ID)
+	if !passed {
+		return false, t.fail(nil)
+	}
+	return t.pass(), nil
+}
+
+// failsAll reports whether a node decides an "all" part: it failed
+func failsAll(result bool) bool {
+	return !result
+}
+
+// decidesAny reports whether a node decides an "any" or "none" part: it passed
+func decidesAny(result bool) bool {
+	return result
+}
+
+// effective reports whether a node is in its effective window at the time of the evaluation
+func (e *evaluation) effective(n node) bool {
+	if !e.program.windowed {
+		return true
+	}
+	switch n := n.(type) {
+	case *compiledRule:
+		return n.rule.EffectiveAt(e.now)
+	case *compiledGroup:
+		return n.metadata.EffectiveAt(e.now)
+	}
+	return true
+}
+
+// noneEffective reports whether every node is outside its effective window
+func (e *evaluation) noneEffective(nodes []node) bool {
+	for _, n := range nodes {
+		if e.effective(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalNodes evaluates the nodes in order until one is decisive and reports whether one was.
+// A node with an error does not decide the part, the nodes after it are still evaluated so
+// the outcome does not depend on the order of the nodes: the error of the first one is
+// returned, as deciding the part, only when no node is decisive. A done context stops the
+// evaluation at once. Nodes outside their effective window are skipped. Nodes run concurrently
+// while the evaluation has free slots, the outcome is still the one of a sequential evaluation.
+func (e *evaluation) evalNodes(nodes []node, t *Trace, decisive func(bool) bool) (bool, error) {
+	if e.slots == nil || len(nodes) < 2 {
+		decided := false
+		var firstErr error
+		for i, n := range nodes {
+			if !e.effective(n) {
+				t.child(i).deactivate()
+				continue
+			}
+			result, err := n.eval(e, t.child(i))
+			if err != nil {
+				if e.ctx.Err() != nil {
+					return true, err
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if !decisive(result) {
+				continue
+			}
+			// a scored evaluation goes on to score the nodes after the decisive one
+			if e.score == nil {
+				return true, nil
+			}
+			decided = true
+		}
+		if decided {
+			return true, nil
+		}
+		return firstErr != nil, firstErr
+	}
+
+	errs := make([]error, len(nodes))
+	// first is the index of the first decisive node found so far, nodes after it are not started
+	var first atomic.Int64
+	first.Store(int64(len(nodes)))
+	evalNode := func(i int) {
+		result, err := nodes[i].eval(e, t.child(i))
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		if !decisive(result) {
+			return
+		}
+		for {
+			current := first.Load()
+			if current <= int64(i) || first.CompareAndSwap(current, int64(i)) {
+				return
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range nodes {
+		if first.Load() < int64(i) {
+			break
+		}
+		if !e.effective(nodes[i]) {
+			t.child(i).deactivate()
+			continue
+		}
+		// run the node in a new goroutine when a slot is free, in this one otherwise, so nested
+		// groups never wait for a slot held by their parent
+		select {
+		case e.slots <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-e.slots
+					wg.Done()
+				}()
+				evalNode(i)
+			}(i)
+		default:
+			evalNode(i)
+		}
+	}
+	wg.Wait()
+
+	if err := e.ctx.Err(); err != nil {
+		return true, err
+	}
+	if first.Load() < int64(len(nodes)) {
+		return true, nil
+	}
+	for _, err := range errs {
+		if err != nil {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// eval checks a single rule, in lenient mode a broken rule simply does not pass.
+// The evaluation stops before the rule once its context is done, even in lenient mode.
+func (r *compiledRule) eval(e *evaluation, t *Trace) (bool, error) {
+	if err := e.ctx.Err(); err != nil {
+		return false, err
+	}
+	t.visit()
+	result, err := r.check(e, t)
+	if err != nil && e.score != nil && errors.Is(err, ErrMissingField) {
+		// in scoring mode a missing field is a rule that does not match and adds nothing,
+		// under a none or a not too, so sparse inputs are still scored
+		return false, t.fail(nil)
+	}
+	if err != nil {
+		t.fail(err)
+		if e.program.lenient && e.ctx.Err() == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	e.addScore(result, r.rule.Weight, r.path, r.rule.ID)
+	if !result {
+		return false, t.fail(nil)
+	}
+	return t.pass(), nil
+}
+
+// check runs the rule against the object, recording the field value in the trace
+func (r *compiledRule) check(e *evaluation, t *Trace) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+
+	var fieldValue interface{}
+	var values []interface{}
+	if r.external != nil {
+		value, err := executeCustom(e.ctx, r.external, e.obj, r.rule.Field)
+		if err != nil {
+			return false, r.fail(err)
+		}
+		fieldValue = value
+	} else {
+		resolved, exists := r.field.resolve(e.obj)
+		if !exists {
+			return false, r.fail(fmt.Errorf("%w %q", ErrMissingField, r.rule.Field))
+		}
+		values = resolved
+		if r.field.wildcard {
+			fieldValue = values
+		} else {
+			fieldValue = values[0]
+		}
+	}
+	t.setFieldValue(fieldValue)
+
+	if r.custom != nil {
+		result, err := executeCustom(e.ctx, r.custom, fieldValue, r.rule.Value)
+		if err != nil {
+			return false, r.fail(err)
+		}
+		return result == true, nil
+	}
+
+	if !r.field.wildcard {
+		result, err := r.apply(fieldValue)
+		if err != nil {
+			return false, r.fail(err)
+		}
+		return result, nil
+	}
+
+	// a wildcard passes when any value passes, or when every value passes for negated operators
+	for _, value := range values {
+		result, err := r.apply(value)
+		if err != nil {
+			return false, r.fail(err)
+		}
+		if result != r.every {
+			return result, nil
+		}
+	}
+	return r.every, nil
+}
+
+// apply runs the operator against a single field value
+func (r *compiledRule) apply(fieldValue interface{}) (bool, error) {
+	if !acceptsAny(r.fieldTypes, fieldValue) {
+		return false, fieldMismatch(describeTypes(r.fieldTypes), fieldValue)
+	}
+	checked, ok := r.operator.(CheckedOperator)
+	if !ok {
+		return r.operator.Apply(fieldValue, r.rule.Value), nil
+	}
+	return checked.Check(fieldValue, r.rule.Value)
+}
+
+// fail wraps an error with the location of the rule
+func (r *compiledRule) fail(err error) error {
+	return &RuleError{Path: r.path, Rule: r.rule, Err: locateMismatch(err, r.rule)}
+}
+
+// compileRule resolves the operator and custom operations of a rule and validates its value
+func compileRule(rule Rule, path string, o *options) *compiledRule {
+	r := &compiledRule{rule: rule, path: path}
+
+	if rule.All != nil || rule.Any != nil || rule.None != nil || rule.Not != nil {
+		r.err = r.fail(fmt.Errorf("%w: a rule can not have both a field or an operator and nested rules", ErrInvalidRules))
+		return r
+	}
+
+	// the schema of the field, it is nil when there is no schema or the field is "external."
+	var schema *Schema
+	if strings.HasPrefix(rule.Field, "external.") {
+		operation, err := lookupCustom(rule.Field, o.custom)
+		if err != nil {
+			r.err = r.fail(err)
+			return r
+		}
+		r.external = operation
+	} else {
+		field, err := parseFieldPath(rule.Field)
+		if err != nil {
+			r.err = r.fail(err)
+			return r
+		}
+		r.field = field
+		if o.schema != nil {
+			if schema, err = o.schema.lookup(field); err != nil {
+				r.err = r.fail(err)
+				return r
+			}
+		}
+	}
+
+	if strings.HasPrefix(rule.Operator, "custom.") {
+		operation, err := lookupCustom(rule.Operator, o.custom)
+		if err != nil {
+			r.err = r.fail(err)
+			return r
+		}
+		r.custom = operation
+		return r
+	}
+
+	operator, spec, err := compileOperator(rule, o)
+	if err != nil {
+		r.err = r.fail(err)
+		return r
+	}
+	if schema != nil {
+		if err := schema.check(rule, spec, o.strict); err != nil {
+			r.err = r.fail(err)
+			return r
+		}
+	}
+	r.operator = operator
+	r.fieldTypes = spec.FieldTypes
+	r.every = spec.Negated
+	return r
+}
+
+// lookupCustom finds the custom operation named by the second segment of "custom.name" or "external.name"
+func lookupCustom(name string, custom map[string]CustomOperation) (CustomOperation, error) {
+	fields := strings.Split(name, ".")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w %q", ErrCustomOperationNotFound, name)
+	}
+	operation, exists := custom[fields[1]]
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrCustomOperationNotFound, fields[1])
+	}
+	return operation, nil
+}
+
+// executeCustom runs a custom operation, passing the context to a ContextOperation
+func executeCustom(ctx context.Context, operation CustomOperation, input, value interface{}) (interface{}, error) {
+	if op, ok := operation.(ContextOperation); ok {
+		return op.ExecuteContext(ctx, input, value)
+	}
+	return operation.Execute(input, value), nil
+}
+
+// compileOperator creates the operator of a rule from the registry and checks the rule value suits it
+func compileOperator(rule Rule, o *options) (Operator, OperatorSpec, error) {
+	registry := o.registry
+	if registry == nil {
+		registry = builtinRegistry
+	}
+	spec, exists := registry.Lookup(rule.Operator)
+	if !exists {
+		return nil, spec, fmt.Errorf("%w %q", ErrUnknownOperator, rule.Operator)
+	}
+
+	operator, err := spec.build(OperatorConfig{Strict: o.strict, Clock: o.clock}, rule.Value)
+	if err != nil {
+		return nil, spec, invalidRules(locateMismatch(err, rule))
+	}
+	return operator, spec, nil
+}
+
+// compiledRegexOperator is a RegexOperator whose pattern has been compiled once
+type compiledRegexOperator struct {
+	re *regexp.Regexp
+}
+
+func (o compiledRegexOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o compiledRegexOperator) Check(fieldValue, _ interface{}) (bool, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return false, fieldMismatch("string", fieldValue)
+	}
+	return o.re.MatchString(value), nil
+}
+
+// isNumber reports whether value is of any numeric type or a json.Number
+func isNumber(value interface{}) bool {
+	_, ok := toNumber(value, false)
+	return ok
+}
+
+// isList reports whether value is a slice or an array
+func isList(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package rule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	rule := func(operator, value string) string {
+		return `{"conditions":[{"all":[{"field":"country","operator":"` + operator + `","value":` + value + `}]}]}`
+	}
+
+	tests := []struct {
+		name  string
+		rules string
+		err   error
+	}{
+		{"valid", rule("in", `["Turkey"]`), nil},
+		{"invalid json", `{"conditions":`, ErrInvalidRules},
+		{"unknown operator", rule("greaterthan", `1`), ErrUnknownOperator},
+		{"custom operator", rule("custom.check", `1`), ErrCustomOperationNotFound},
+		{"in without array", rule("in", `"Turkey"`), ErrInvalidRules},
+		{"greaterThan without number", rule("greaterThan", `true`), ErrInvalidRules},
+		{"startsWith without string", rule("startsWith", `1`), ErrInvalidRules},
+		{"invalid pattern", rule("regex", `"[a-"`), ErrInvalidRules},
+	}
+
+	for _, test := range tests {
+		program, err := Compile(test.rules)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v; expected %v", test.name, err, test.err)
+		}
+		if (program == nil) == (test.err == nil) {
+			t.Errorf("%s: program = %v", test.name, program)
+		}
+	}
+}
+
+func TestCompileErrorMessage(t *testing.T) {
+	rules := `{"conditions":[{"all":[{"field":"country","operator":"in","value":"Turkey"}]}]}`
+
+	_, err := Compile(rules)
+	expected := `conditions[0].all[0]: rule: invalid rules: type mismatch: operator "in" expects an array value for field "country", got string`
+	if err == nil || err.Error() != expected {
+		t.Errorf("error = %v; expected %s", err, expected)
+	}
+
+	// a field that is not numeric is blamed for an ordering against a number
+	rules = `{"conditions":[{"all":[{"field":"country","operator":"greaterThan","value":5}]}]}`
+	_, err = Evaluate(`{"country":"Turkey"}`, rules, nil)
+	expected = `conditions[0].all[0]: rule: type mismatch: operator "greaterThan" expects a number field for field "country", got string`
+	if err == nil || err.Error() != expected {
+		t.Errorf("error = %v; expected %s", err, expected)
+	}
+}
+
+func TestProgramEval(t *testing.T) {
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"city",
+				   "operator":"regex",
+				   "value":"^Ist"
+				},
+				{
+				   "field":"external.score",
+				   "operator":"equals",
+				   "value":true
+				}
+			 ],
+			 "any":[
+				{
+				   "field":"country",
+				   "operator":"in",
+				   "value":["Turkey", "England"]
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	program, err := Compile(rules, WithCustom(map[string]CustomOperation{"score": &CustomInput{}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`{"country":"Turkey","city":"Istanbul"}`, true},
+		{`{"country":"England","city":"Istanbul"}`, true},
+		{`{"country":"Germany","city":"Istanbul"}`, false},
+		{`{"country":"Turkey","city":"Izmir"}`, false},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, test := range tests {
+				result, err := program.Eval(test.input)
+				if err != nil {
+					t.Errorf("Eval(%s) unexpected error: %v", test.input, err)
+				}
+				if result != test.expected {
+					t.Errorf("Eval(%s) = %v; expected %v", test.input, result, test.expected)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestProgramEvalWithNestedGroups(t *testing.T) {
+	// country = Turkey and (vip or (population > 1000 and not city = Ankara))
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"country",
+				   "operator":"equals",
+				   "value":"Turkey"
+				},
+				{
+				   "any":[
+					  {
+						 "field":"vip",
+						 "operator":"equals",
+						 "value":true
+					  },
+					  {
+						 "all":[
+							{
+							   "field":"population",
+							   "operator":"greaterThan",
+							   "value":1000
+							},
+							{
+							   "not":{
+								  "field":"city",
+								  "operator":"equals",
+								  "value":"Ankara"
+							   }
+							}
+						 ]
+					  }
+				   ]
+				}
+			 ],
+			 "none":[
+				{
+				   "field":"blocked",
+				   "operator":"equals",
+				   "value":true
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	program, err := Compile(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`{"country":"Turkey","vip":true,"population":10,"city":"Ankara","blocked":false}`, true},
+		{`{"country":"Turkey","vip":false,"population":5000,"city":"Istanbul","blocked":false}`, true},
+		{`{"country":"Turkey","vip":false,"population":5000,"city":"Ankara","blocked":false}`, false},
+		{`{"country":"Turkey","vip":false,"population":10,"city":"Istanbul","blocked":false}`, false},
+		{`{"country":"Turkey","vip":true,"population":10,"city":"Ankara","blocked":true}`, false},
+		{`{"country":"England","vip":true,"population":10,"city":"London","blocked":false}`, false},
+	}
+
+	for _, test := range tests {
+		result, err := program.Eval(test.input)
+		if err != nil {
+			t.Errorf("Eval(%s) unexpected error: %v", test.input, err)
+		}
+		if result != test.expected {
+			t.Errorf("Eval(%s) = %v; expected %v", test.input, result, test.expected)
+		}
+	}
+
+	_, err = program.Eval(`{"country":"Turkey","vip":false,"population":5000,"blocked":false}`)
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Path != "conditions[0].all[1].any[1].all[1].not" {
+		t.Errorf("error = %v; expected missing city at conditions[0].all[1].any[1].all[1].not", err)
+	}
+}
+
+func TestCompileWithInvalidGroup(t *testing.T) {
+	rules := `{"conditions":[{"all":[{"field":"country","operator":"equals","value":"Turkey","any":[]}]}]}`
+	if _, err := Compile(rules); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("error = %v; expected %v", err, ErrInvalidRules)
+	}
+}
+
+// slowLookup is a ContextOperation that waits for its context, like a lookup of a slow database
+type slowLookup struct {
+	calls int
+}
+
+func (o *slowLookup) Execute(input, value interface{}) interface{} {
+	result, _ := o.ExecuteContext(context.Background(), input, value)
+	return result
+}
+
+func (o *slowLookup) ExecuteContext(ctx context.Context, _, _ interface{}) (interface{}, error) {
+	o.calls++
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Second):
+		return "gold", nil
+	}
+}
+
+func TestProgramEvalContext(t *testing.T) {
+	lookup := &slowLookup{}
+	rules := `{"conditions":[{"all":[
+		{"field":"external.tier","operator":"equals","value":"gold"},
+		{"field":"external.tier","operator":"equals","value":"gold"}
+	]}]}`
+	input := `{"country":"Turkey"}`
+
+	for _, opts := range [][]Option{{WithCustom(map[string]CustomOperation{"tier": lookup})}, {WithCustom(map[string]CustomOperation{"tier": lookup}), withLenient()}} {
+		program, err := Compile(rules, opts...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		lookup.calls = 0
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		start := time.Now()
+		result, err := program.EvalContext(ctx, input)
+		cancel()
+		if result || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("EvalContext() = %v, %v; expected %v", result, err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("EvalContext() took %v; expected to stop at the deadline", elapsed)
+		}
+		if lookup.calls != 1 {
+			t.Errorf("lookup called %d times; expected the evaluation to stop after the first rule", lookup.calls)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if _, err := program.ExplainContext(ctx, input); !errors.Is(err, context.Canceled) {
+			t.Errorf("ExplainContext() error = %v; expected %v", err, context.Canceled)
+		}
+	}
+
+	if _, err := EvaluateContext(context.Background(), input, `{"conditions":[{"all":[{"field":"country","operator":"equals","value":"Turkey"}]}]}`, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// concurrencyProbe is a custom operator that records how many evaluations run at once. When
+// overlap is set, an evaluation waits for another one to start until two have run at once.
+type concurrencyProbe struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	overlap chan struct{}
+}
+
+func (o *concurrencyProbe) Execute(input, value interface{}) interface{} {
+	o.mu.Lock()
+	o.running++
+	if o.running > o.max {
+		o.max = o.running
+	}
+	if o.overlap != nil && o.running == 2 {
+		select {
+		case <-o.overlap:
+		default:
+			close(o.overlap)
+		}
+	}
+	o.mu.Unlock()
+
+	if o.overlap != nil {
+		// the timeout is only reached when the rules are not evaluated at once
+		select {
+		case <-o.overlap:
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	o.mu.Lock()
+	o.running--
+	o.mu.Unlock()
+	return input == value
+}
+
+func TestProgramEvalWithParallelism(t *testing.T) {
+	input := `{"country":"Turkey","city":"Istanbul"}`
+	tests := []struct {
+		rules    string
+		expected bool
+		err      error
+	}{
+		{`{"conditions":[
+			{"all":[{"field":"country","operator":"custom.probe","value":"Turkey"},{"field":"city","operator":"custom.probe","value":"Istanbul"}]},
+			{"any":[{"field":"country","operator":"custom.probe","value":"Germany"},{"field":"city","operator":"custom.probe","value":"Istanbul"}]},
+			{"none":[{"field":"country","operator":"custom.probe","value":"Germany"},{"field":"city","operator":"custom.probe","value":"Berlin"}]},
+			{"all":[{"any":[{"field":"country","operator":"custom.probe","value":"Germany"},{"field":"country","operator":"custom.probe","value":"Turkey"}]}]}
+		]}`, true, nil},
+		{`{"conditions":[
+			{"all":[{"field":"country","operator":"custom.probe","value":"Turkey"},{"field":"city","operator":"custom.probe","value":"Berlin"}]},
+			{"all":[{"field":"population","operator":"greaterThan","value":1}]}
+		]}`, false, nil},
+		// an error does not decide an "any", a rule after it that passes does, in any order
+		{`{"conditions":[{"any":[
+			{"field":"population","operator":"greaterThan","value":1},
+			{"field":"country","operator":"custom.probe","value":"Turkey"}
+		]}]}`, true, nil},
+		{`{"conditions":[{"any":[
+			{"field":"population","operator":"greaterThan","value":1},
+			{"field":"country","operator":"custom.probe","value":"Germany"}
+		]}]}`, false, ErrMissingField},
+		{`{"conditions":[{"any":[
+			{"field":"country","operator":"custom.probe","value":"Turkey"},
+			{"field":"population","operator":"greaterThan","value":1}
+		]}]}`, true, nil},
+	}
+
+	for _, parallelism := range []int{1, 2, 4} {
+		probe := &concurrencyProbe{}
+		if parallelism > 1 {
+			probe.overlap = make(chan struct{})
+		}
+		for _, test := range tests {
+			program, err := Compile(test.rules, WithCustom(map[string]CustomOperation{"probe": probe}), WithParallelism(parallelism))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result, err := program.Eval(input)
+			if result != test.expected || !errors.Is(err, test.err) {
+				t.Errorf("parallelism %d: Eval(%s) = %v, %v; expected %v, %v", parallelism, test.rules, result, err, test.expected, test.err)
+			}
+		}
+		if probe.max > parallelism {
+			t.Errorf("parallelism %d: %d rules were evaluated at once", parallelism, probe.max)
+		}
+		if parallelism > 1 && probe.max < 2 {
+			t.Errorf("parallelism %d: expected rules to be evaluated at once", parallelism)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperatorConfig holds the compile options an operator may depend on
+type OperatorConfig struct {
+	// Strict is set by WithStrictTypes
+	Strict bool
+	// Clock is set by WithClock, it is nil when time.Now should be used
+	Clock func() time.Time
+}
+
+// Comparison tells how the rule value of an operator relates to the field value
+type Comparison int
+
+const (
+	// CompareNone is for rule values that are not field values, e.g. a pattern or a period
+	CompareNone Comparison = iota
+	// CompareValue is for a rule value compared with the field value, it must be of the type of the field
+	CompareValue
+	// CompareElements is for a list of rule values compared with the field value
+	CompareElements
+)
+
+// OperatorSpec describes an operator registered under a name
+type OperatorSpec struct {
+	// Operator is applied to the rules using the name, it can be left nil when Build is set
+	Operator Operator
+	// Build, when set, creates the operator of each rule at compile time instead of using
+	// Operator, so it can depend on the compile options and validate or precompile the rule value
+	Build func(config OperatorConfig, ruleValue interface{}) (Operator, error)
+	// FieldTypes lists the field value types the operator accepts, empty accepts any
+	FieldTypes []Type
+	// ValueTypes lists the rule value types the operator accepts, empty accepts any
+	ValueTypes []Type
+	// Negated makes a wildcard field pass only when the operator passes for every value,
+	// instead of any value
+	Negated bool
+	// Compares lets WithSchema check the rule value against the type of the field
+	Compares Comparison
+}
+
+// Registry maps operator names used in rules to operators. Registries are scoped, pass one
+// to Compile with WithRegistry, it is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	specs map[string]OperatorSpec
+}
+
+// NewRegistry returns a registry holding the built-in operators
+func NewRegistry() *Registry {
+	return builtinRegistry.Clone()
+}
+
+// NewEmptyRegistry returns a registry without any operator
+func NewEmptyRegistry() *Registry {
+	return &Registry{specs: map[string]OperatorSpec{}}
+}
+
+// Register adds an operator, an operator already registered under the name is replaced
+func (r *Registry) Register(name string, spec OperatorSpec) error {
+	if name == "" || (spec.Operator == nil && spec.Build == nil) {
+		return fmt.Errorf("rule: operator %q needs a name and an Operator or a Build function", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.specs[name] = spec
+	return nil
+}
+
+// RegisterOperator adds an operator accepting any field and rule value
+func (r *Registry) RegisterOperator(name string, operator Operator) error {
+	return r.Register(name, OperatorSpec{Operator: operator})
+}
+
+// Disable removes an operator, rules using it fail to compile with ErrUnknownOperator
+func (r *Registry) Disable(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.specs, name)
+}
+
+// Lookup returns the operator registered under the name
+func (r *Registry) Lookup(name string) (OperatorSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, exists := r.specs[name]
+	return spec, exists
+}
+
+// Names returns the sorted names of the registered operators
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of the registry that can be changed independently
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewEmptyRegistry()
+	for name, spec := range r.specs {
+		clone.specs[name] = spec
+	}
+	return clone
+}
+
+// build creates the operator of a rule and checks the rule value suits it
+func (spec OperatorSpec) build(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+	if !acceptsAny(spec.ValueTypes, ruleValue) {
+		return nil, valueMismatch(describeTypes(spec.ValueTypes), ruleValue)
+	}
+	if spec.Build == nil {
+		return spec.Operator, nil
+	}
+	return spec.Build(config, ruleValue)
+}
+
+// builtinRegistry holds the built-in operators, it is never changed
+var builtinRegistry = &Registry{specs: map[string]OperatorSpec{
+	"equals": {
+		Operator: EqualsOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return EqualsOperator{Strict: config.Strict}, nil
+		},
+		Compares: CompareValue,
+	},
+	"notEquals": {
+		Operator: NotEqualsOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return NotEqualsOperator{Strict: config.Strict}, nil
+		},
+		Negated:  true,
+		Compares: CompareValue,
+	},
+	"greaterThan": {
+		Operator: GreaterThanOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return GreaterThanOperator{Strict: config.Strict}, nil
+		},
+		FieldTypes: []Type{TypeNumber, TypeString},
+		ValueTypes: []Type{TypeNumber, TypeString},
+		Compares:   CompareValue,
+	},
+	"lessThan": {
+		Operator: LessThanOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return LessThanOperator{Strict: config.Strict}, nil
+		},
+		FieldTypes: []Type{TypeNumber, TypeString},
+		ValueTypes: []Type{TypeNumber, TypeString},
+		Compares:   CompareValue,
+	},
+	"greaterThanInclusive": {
+		Operator: GreaterThanInclusiveOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return GreaterThanInclusiveOperator{Strict: config.Strict}, nil
+		},
+		FieldTypes: []Type{TypeNumber, TypeString},
+		ValueTypes: []Type{TypeNumber, TypeString},
+		Compares:   CompareValue,
+	},
+	"lessThanInclusive": {
+		Operator: LessThanInclusiveOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return LessThanInclusiveOperator{Strict: config.Strict}, nil
+		},
+		FieldTypes: []Type{TypeNumber, TypeString},
+		ValueTypes: []Type{TypeNumber, TypeString},
+		Compares:   CompareValue,
+	},
+	"in": {
+		Operator: InOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return InOperator{Strict: config.Strict}, nil
+		},
+		ValueTypes: []Type{TypeArray},
+		Compares:   CompareElements,
+	},
+	"notIn": {
+		Operator: NotInOperator{},
+		Build: func(config OperatorConfig, _ interface{}) (Operator, error) {
+			return NotInOperator{Strict: config.Strict}, nil
+		},
+		ValueTypes: []Type{TypeArray},
+		Negated:    true,
+		Compares:   CompareElements,
+	},
+	"startsWith": {
+		Operator:   StartsWithOperator{},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+	},
+	"endsWith": {
+		Operator:   EndsWithOperator{},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+	},
+	"contains": {
+		Operator:   ContainsOperator{},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+	},
+	"notContains": {
+		Operator:   NotContainsOperator{},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+		Negated:    true,
+	},
+	"regex": {
+		Operator: RegexOperator{},
+		Build: func(_ OperatorConfig, ruleValue interface{}) (Operator, error) {
+			re, err := regexp.Compile(ruleValue.(string))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern: %w", err)
+			}
+			return compiledRegexOperator{re: re}, nil
+		},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+	},
+	"before": {
+		Operator: BeforeOperator{},
+		Build: func(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+			point, err := parsePoint(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return field.Before(point.at(now(config.Clock)))
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+	},
+	"after": {
+		Operator: AfterOperator{},
+		Build: func(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+			point, err := parsePoint(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return field.After(point.at(now(config.Clock)))
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+	},
+	"between": {
+		Operator: BetweenOperator{},
+		Build: func(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+			from, to, err := parseRange(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return inRange(field, from, to, now(config.Clock))
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+		ValueTypes: []Type{TypeArray},
+	},
+	"withinLast": {
+		Operator: WithinLastOperator{},
+		Build: func(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+			p, err := parsePeriod(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return withinLast(field, p, now(config.Clock))
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+		ValueTypes: []Type{TypeString, TypeNumber},
+	},
+	"olderThan": {
+		Operator: OlderThanOperator{},
+		Build: func(config OperatorConfig, ruleValue interface{}) (Operator, error) {
+			p, err := parsePeriod(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return field.Before(p.ago(now(config.Clock)))
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+		ValueTypes: []Type{TypeString, TypeNumber},
+	},
+	"dayOfWeekIn": {
+		Operator: DayOfWeekInOperator{},
+		Build: func(_ OperatorConfig, ruleValue interface{}) (Operator, error) {
+			days, loc, err := parseDays(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return inDays(field, days, loc)
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+		ValueTypes: []Type{TypeArray, TypeObject},
+	},
+	"timeOfDayBetween": {
+		Operator: TimeOfDayBetweenOperator{},
+		Build: func(_ OperatorConfig, ruleValue interface{}) (Operator, error) {
+			from, to, loc, err := parseClockRange(ruleValue)
+			return compiledTimeOperator{check: func(field time.Time) bool {
+				return inClockRange(field, from, to, loc)
+			}}, err
+		},
+		FieldTypes: []Type{TypeTime},
+		ValueTypes: []Type{TypeArray, TypeObject},
+	},
+}}
@@ -0,0 +1,87 @@
+package rule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// EqualFoldOperator checks if fieldValue equals ruleValue ignoring case
+type EqualFoldOperator struct{}
+
+func (o EqualFoldOperator) Apply(fieldValue, ruleValue interface{}) bool {
+	return strings.EqualFold(fieldValue.(string), ruleValue.(string))
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register("equalFold", OperatorSpec{
+		Operator:   EqualFoldOperator{},
+		FieldTypes: []Type{TypeString},
+		ValueTypes: []Type{TypeString},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := registry.RegisterOperator("equals", EqualFoldOperator{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// an operator can be registered with a Build function only
+	if err := registry.Register("prefix", OperatorSpec{
+		Build: func(_ OperatorConfig, ruleValue interface{}) (Operator, error) {
+			return StartsWithOperator{}, nil
+		},
+		FieldTypes: []Type{TypeString},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	registry.Disable("regex")
+
+	rule := func(operator, value string) string {
+		return `{"conditions":[{"all":[{"field":"country","operator":"` + operator + `","value":` + value + `}]}]}`
+	}
+
+	tests := []struct {
+		rules    string
+		input    string
+		expected bool
+		err      error
+	}{
+		{rule("equalFold", `"TURKEY"`), `{"country":"Turkey"}`, true, nil},
+		{rule("prefix", `"Tur"`), `{"country":"Turkey"}`, true, nil},
+		{rule("equals", `"TURKEY"`), `{"country":"Turkey"}`, true, nil},
+		{rule("in", `["Turkey"]`), `{"country":"Turkey"}`, true, nil},
+		{rule("equalFold", `"TURKEY"`), `{"country":90}`, false, ErrTypeMismatch},
+		{rule("equalFold", `90`), `{"country":"Turkey"}`, false, ErrInvalidRules},
+		{rule("regex", `"^T"`), `{"country":"Turkey"}`, false, ErrUnknownOperator},
+	}
+
+	for _, test := range tests {
+		program, err := Compile(test.rules, WithRegistry(registry))
+		if err == nil {
+			var result bool
+			result, err = program.Eval(test.input)
+			if result != test.expected {
+				t.Errorf("Eval(%s, %s) = %v; expected %v", test.rules, test.input, result, test.expected)
+			}
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("Eval(%s, %s) error = %v; expected %v", test.rules, test.input, err, test.err)
+		}
+	}
+
+	if _, err := Compile(rule("equalFold", `"TURKEY"`)); !errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("error = %v; expected operators to be scoped to the registry", err)
+	}
+	if _, exists := NewRegistry().Lookup("regex"); !exists {
+		t.Errorf("expected regex in a new registry")
+	}
+	if names := NewEmptyRegistry().Names(); len(names) != 0 {
+		t.Errorf("Names() = %v; expected none", names)
+	}
+	if err := registry.Register("", OperatorSpec{}); err == nil {
+		t.Errorf("expected an error registering an operator without a name")
+	}
+	if err := registry.Register("nothing", OperatorSpec{}); err == nil {
+		t.Errorf("expected an error registering an operator without an Operator or a Build function")
+	}
+}
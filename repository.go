@@ -0,0 +1,254 @@
+package rule
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Repository keeps the rule sets of an Engine in sync with the rule documents of a
+// directory. Every JSON, YAML, TOML or expression file of the directory is a rule set
+// named by the file name without its extension, test files are skipped. The priority of a
+// rule set is the priority of its document.
+//
+// A changed document is compiled before it replaces the rule set, a document that does not
+// compile is reported and the last version that did keeps being evaluated. The rule sets
+// of a reload are swapped into the engine at once, so a run never sees some of the changes only.
+type Repository struct {
+	dir    string
+	engine *Engine
+
+	// mu serializes reloads and guards files
+	mu    sync.Mutex
+	files map[string]*repositoryFile
+	// duplicates are the modification times of the documents whose rule set is defined by
+	// another document, so they are reported once until they change
+	duplicates map[string]time.Time
+	// loaded is set once the rule sets of the engine have been replaced
+	loaded bool
+
+	subscribersMu sync.Mutex
+	subscribers   map[int]func(ReloadEvent)
+	subscribed    int
+}
+
+// repositoryFile is the state of a rule document of a Repository
+type repositoryFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	data    []byte
+	// program is the last version of the document that compiled, it is nil when no version did
+	program *Program
+}
+
+// ReloadEvent tells what a reload of a Repository changed
+type ReloadEvent struct {
+	Time    time.Time
+	Added   []string
+	Updated []string
+	Removed []string
+	// Errors are RuleSetErrors for the documents that do not compile, or the error reading
+	// the directory. Their rule sets keep the last version that compiled.
+	Errors []error
+}
+
+// Changed reports whether the reload changed the rule sets of the engine
+func (e ReloadEvent) Changed() bool {
+	return len(e.Added) > 0 || len(e.Updated) > 0 || len(e.Removed) > 0
+}
+
+// Err joins the errors of the reload
+func (e ReloadEvent) Err() error {
+	return errors.Join(e.Errors...)
+}
+
+// NewRepository loads the rule documents of the directory into the engine, replacing its
+// rule sets. The documents are compiled with the options of the engine. The returned error
+// is the error of the first load, the repository is returned with the documents that did
+// compile unless the directory can not be read.
+func NewRepository(dir string, engine *Engine) (*Repository, error) {
+	r := &Repository{dir: dir, engine: engine, files: map[string]*repositoryFile{}, duplicates: map[string]time.Time{}, subscribers: map[int]func(ReloadEvent){}}
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	event := r.Reload()
+	return r, event.Err()
+}
+
+// Engine returns the engine the repository loads the rule sets into
+func (r *Repository) Engine() *Engine {
+	return r.engine
+}
+
+// Subscribe calls fn with the event of every reload that changed a rule set or found an
+// error, until the returned function is called. Events are delivered one at a time, in
+// order, by the reload, so fn must not reload the repository itself.
+func (r *Repository) Subscribe(fn func(ReloadEvent)) func() {
+	r.subscribersMu.Lock()
+	defer r.subscribersMu.Unlock()
+	r.subscribed++
+	id := r.subscribed
+	r.subscribers[id] = fn
+	return func() {
+		r.subscribersMu.Lock()
+		defer r.subscribersMu.Unlock()
+		delete(r.subscribers, id)
+	}
+}
+
+// Watch reloads the directory every interval until the context is done. Only the
+// documents whose modification time or size changed are read again.
+func (r *Repository) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.Reload()
+		}
+	}
+}
+
+// Reload compiles the documents that changed since the last reload and swaps the rule
+// sets into the engine when any of them changed
+func (r *Repository) Reload() ReloadEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := ReloadEvent{Time: time.Now()}
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		event.Errors = append(event.Errors, err)
+		r.notify(event)
+		return event
+	}
+
+	seen := map[string]bool{}
+	duplicates := map[string]time.Time{}
+	for _, entry := range entries {
+		name := entry.Name()
+		format, err := FormatOf(name)
+		if entry.IsDir() || err != nil || strings.Contains(name, ".test.") {
+			continue
+		}
+		id := strings.TrimSuffix(name, filepath.Ext(name))
+		path := filepath.Join(r.dir, name)
+		if seen[id] {
+			var modTime time.Time
+			if info, err := entry.Info(); err == nil {
+				modTime = info.ModTime()
+			}
+			if reported, exists := r.duplicates[path]; !exists || !reported.Equal(modTime) {
+				event.Errors = append(event.Errors, &RuleSetError{ID: id, Err: fmt.Errorf("%s: the rule set is defined twice", path)})
+			}
+			duplicates[path] = modTime
+			continue
+		}
+		seen[id] = true
+
+		if err := r.load(id, path, format, &event); err != nil {
+			event.Errors = append(event.Errors, &RuleSetError{ID: id, Err: err})
+		}
+	}
+	r.duplicates = duplicates
+	for id, file := range r.files {
+		if !seen[id] {
+			delete(r.files, id)
+			if file.program != nil {
+				event.Removed = append(event.Removed, id)
+			}
+		}
+	}
+
+	sort.Strings(event.Added)
+	sort.Strings(event.Updated)
+	sort.Strings(event.Removed)
+	if event.Changed() || !r.loaded {
+		r.loaded = true
+		ids := make([]string, 0, len(r.files))
+		for id, file := range r.files {
+			if file.program != nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		swapped := make([]EngineEntry, 0, len(ids))
+		for _, id := range ids {
+			program := r.files[id].program
+			swapped = append(swapped, EngineEntry{ID: id, Priority: program.ruleSet.Priority, Program: program})
+		}
+		r.engine.Replace(swapped)
+	}
+	r.notify(event)
+	return event
+}
+
+// load compiles a document when it changed, recording the change in the event
+func (r *Repository) load(id, path string, format Format, event *ReloadEvent) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	file, exists := r.files[id]
+	if exists && file.path == path && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		file = &repositoryFile{}
+		r.files[id] = file
+	}
+	unchanged := file.path == path && bytes.Equal(file.data, data)
+	file.path, file.modTime, file.size, file.data = path, info.ModTime(), info.Size(), data
+	if unchanged {
+		return nil
+	}
+
+	program, err := CompileDocument(data, format, r.engine.opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if file.program == nil {
+		event.Added = append(event.Added, id)
+	} else {
+		event.Updated = append(event.Updated, id)
+	}
+	file.program = program
+	return nil
+}
+
+// notify delivers an event to the subscribers
+func (r *Repository) notify(event ReloadEvent) {
+	if !event.Changed() && len(event.Errors) == 0 {
+		return
+	}
+	r.subscribersMu.Lock()
+	ids := make([]int, 0, len(r.subscribers))
+	for id := range r.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subscribers := make([]func(ReloadEvent), 0, len(ids))
+	for _, id := range ids {
+		subscribers = append(subscribers, r.subscribers[id])
+	}
+	r.subscribersMu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
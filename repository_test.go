@@ -0,0 +1,192 @@
+package rule
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeRuleFile writes a rule document and moves its modification time forward, so a
+// change is seen even when the clock of the file system is coarse
+func writeRuleFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeRuleFile(t, dir, "gold.json", `{"conditions":[{"all":[{"field":"tier","operator":"equals","value":"gold"}]}]}`)
+	writeRuleFile(t, dir, "large.expr", `total > 1000`)
+	writeRuleFile(t, dir, "vip.json", `{"conditions":[{"all":[{"field":"tier","operator":"equals","value":"vip"}]}],"priority":10}`)
+	writeRuleFile(t, dir, "large.test.yaml", "rules: large.expr\ntests: []\n")
+
+	engine := NewEngine(AllMatches)
+	engine.Add("stale", 0, `{"conditions":[]}`)
+	repository, err := NewRepository(dir, engine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// rule sets are ordered by the priority of their documents
+	if ids := engine.IDs(); !reflect.DeepEqual(ids, []string{"vip", "gold", "large"}) {
+		t.Fatalf("IDs() = %v; expected the rule sets of the directory only", ids)
+	}
+	if entry, _ := engine.Entry("vip"); entry.Priority != 10 {
+		t.Errorf("priority = %d; expected the priority of the document", entry.Priority)
+	}
+
+	var events []ReloadEvent
+	unsubscribe := repository.Subscribe(func(event ReloadEvent) {
+		events = append(events, event)
+	})
+
+	if event := repository.Reload(); event.Changed() || len(event.Errors) > 0 || len(events) != 0 {
+		t.Errorf("Reload() = %+v; expected no change when no document changed", event)
+	}
+
+	writeRuleFile(t, dir, "large.expr", `total > 10`)
+	writeRuleFile(t, dir, "small.expr", `total < 10`)
+	os.Remove(filepath.Join(dir, "gold.json"))
+	event := repository.Reload()
+	if !reflect.DeepEqual(event.Added, []string{"small"}) || !reflect.DeepEqual(event.Updated, []string{"large"}) || !reflect.DeepEqual(event.Removed, []string{"gold"}) {
+		t.Errorf("Reload() = %+v; expected small to be added, large updated and gold removed", event)
+	}
+	if matches, _ := engine.Run(`{"total": 100}`); len(matches) != 1 || matches[0].ID != "large" {
+		t.Errorf("matches = %+v; expected the new version of large to match", matches)
+	}
+	if len(events) != 1 {
+		t.Errorf("events = %+v; expected the reload to be notified", events)
+	}
+
+	unsubscribe()
+	repository.Reload()
+	if len(events) != 1 {
+		t.Errorf("events = %+v; expected no event after unsubscribing", events)
+	}
+}
+
+func TestRepositoryKeepsLastGoodVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeRuleFile(t, dir, "large.expr", `total > 1000`)
+	writeRuleFile(t, dir, "broken.json", `{"conditions": [`)
+
+	engine := NewEngine(AllMatches)
+	repository, err := NewRepository(dir, engine)
+	var ruleSetErr *RuleSetError
+	if !errors.As(err, &ruleSetErr) || ruleSetErr.ID != "broken" || !errors.Is(err, ErrInvalidRules) {
+		t.Fatalf("NewRepository() error = %v; expected the broken document", err)
+	}
+	if ids := engine.IDs(); !reflect.DeepEqual(ids, []string{"large"}) {
+		t.Fatalf("IDs() = %v; expected the documents that compile", ids)
+	}
+
+	writeRuleFile(t, dir, "large.expr", `total >`)
+	event := repository.Reload()
+	if event.Changed() || len(event.Errors) != 1 {
+		t.Errorf("Reload() = %+v; expected an error and no change", event)
+	}
+	if matches, err := engine.Run(`{"total": 5000}`); err != nil || len(matches) != 1 {
+		t.Errorf("Run() = %+v, %v; expected the last good version to be evaluated", matches, err)
+	}
+
+	// an unchanged broken document is not reported again
+	if event := repository.Reload(); len(event.Errors) != 0 {
+		t.Errorf("Reload() = %+v; expected no error for an unchanged document", event)
+	}
+
+	writeRuleFile(t, dir, "large.expr", `total > 10000`)
+	if event := repository.Reload(); !reflect.DeepEqual(event.Updated, []string{"large"}) {
+		t.Errorf("Reload() = %+v; expected the fixed document to be loaded", event)
+	}
+
+	writeRuleFile(t, dir, "large.json", `{"conditions":[]}`)
+	if event := repository.Reload(); len(event.Errors) != 1 || !strings.Contains(event.Errors[0].Error(), "defined twice") {
+		t.Errorf("Reload() = %+v; expected an error for a rule set defined twice", event)
+	}
+	if event := repository.Reload(); len(event.Errors) != 0 {
+		t.Errorf("Reload() = %+v; expected a rule set defined twice to be reported once", event)
+	}
+	writeRuleFile(t, dir, "large.json", `{"conditions":[],"priority":1}`)
+	if event := repository.Reload(); len(event.Errors) != 1 {
+		t.Errorf("Reload() = %+v; expected a changed duplicate to be reported again", event)
+	}
+
+	if _, err := NewRepository(filepath.Join(dir, "missing"), engine); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected an error for a missing directory; got %v", err)
+	}
+}
+
+func TestRepositoryWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeRuleFile(t, dir, "large.expr", `total > 1000`)
+	engine := NewEngine(AllMatches)
+	repository, err := NewRepository(dir, engine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded := make(chan ReloadEvent, 10)
+	repository.Subscribe(func(event ReloadEvent) {
+		reloaded <- event
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	watching := make(chan error, 1)
+	go func() {
+		watching <- repository.Watch(ctx, 10*time.Millisecond)
+	}()
+
+	// runs in flight while the rule sets are swapped see either version, never none
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if matches, err := engine.Run(`{"total": 5000}`); err != nil || len(matches) != 1 {
+					t.Errorf("Run() = %+v, %v; expected a single match", matches, err)
+					return
+				}
+			}
+		}()
+	}
+
+	writeRuleFile(t, dir, "large.expr", `total > 2000`)
+	select {
+	case event := <-reloaded:
+		if !reflect.DeepEqual(event.Updated, []string{"large"}) {
+			t.Errorf("event = %+v; expected large to be updated", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the change to be picked up")
+	}
+	close(stop)
+	wg.Wait()
+
+	cancel()
+	if err := <-watching; !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch() = %v; expected the error of the context", err)
+	}
+}
@@ -1,10 +1,13 @@
 package rule
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Operator defines an interface for all operators
@@ -12,182 +15,351 @@ type Operator interface {
 	Apply(fieldValue, ruleValue interface{}) bool
 }
 
-// EqualsOperator checks if fieldValue equals ruleValue
-type EqualsOperator struct{}
+// CheckedOperator is an Operator that reports why its operands could not be compared,
+// all built-in operators implement it
+type CheckedOperator interface {
+	Operator
+	Check(fieldValue, ruleValue interface{}) (bool, error)
+}
+
+// EqualsOperator checks if fieldValue equals ruleValue, numbers of different types
+// are equal when they have the same value unless Strict is set
+type EqualsOperator struct {
+	Strict bool
+}
 
 func (o EqualsOperator) Apply(fieldValue interface{}, ruleValue interface{}) bool {
-	return reflect.DeepEqual(fieldValue, ruleValue)
+	return equals(fieldValue, ruleValue, o.Strict)
+}
+
+func (o EqualsOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	return o.Apply(fieldValue, ruleValue), nil
 }
 
 // NotEqualsOperator checks if fieldValue not equals ruleValue
-type NotEqualsOperator struct{}
+type NotEqualsOperator struct {
+	Strict bool
+}
 
 func (o NotEqualsOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return !reflect.DeepEqual(fieldValue, ruleValue)
+	return !equals(fieldValue, ruleValue, o.Strict)
+}
+
+func (o NotEqualsOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	return o.Apply(fieldValue, ruleValue), nil
 }
 
 // GreaterThanOperator checks if fieldValue is greater than ruleValue
-type GreaterThanOperator struct{}
+type GreaterThanOperator struct {
+	Strict bool
+}
 
 func (o GreaterThanOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return compare(fieldValue, ruleValue) > 0
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o GreaterThanOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	result, err := compare(fieldValue, ruleValue, o.Strict)
+	return err == nil && result > 0, err
 }
 
 // LessThanOperator checks if fieldValue is less than ruleValue
-type LessThanOperator struct{}
+type LessThanOperator struct {
+	Strict bool
+}
 
 func (o LessThanOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return compare(fieldValue, ruleValue) < 0
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o LessThanOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	result, err := compare(fieldValue, ruleValue, o.Strict)
+	return err == nil && result < 0, err
 }
 
 // GreaterThanInclusiveOperator checks if fieldValue is greater than or equals to ruleValue
-type GreaterThanInclusiveOperator struct{}
+type GreaterThanInclusiveOperator struct {
+	Strict bool
+}
 
 func (o GreaterThanInclusiveOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return compare(fieldValue, ruleValue) >= 0
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o GreaterThanInclusiveOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	result, err := compare(fieldValue, ruleValue, o.Strict)
+	return err == nil && result >= 0, err
 }
 
 // LessThanInclusiveOperator checks if fieldValue is less than or equals to ruleValue
-type LessThanInclusiveOperator struct{}
+type LessThanInclusiveOperator struct {
+	Strict bool
+}
 
 func (o LessThanInclusiveOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return compare(fieldValue, ruleValue) <= 0
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o LessThanInclusiveOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	result, err := compare(fieldValue, ruleValue, o.Strict)
+	return err == nil && result <= 0, err
 }
 
 // InOperator checks if fieldValue is in ruleValue array
-type InOperator struct{}
+type InOperator struct {
+	Strict bool
+}
 
 func (o InOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return Contains(fieldValue, ruleValue)
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o InOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	if !isList(ruleValue) {
+		return false, valueMismatch("array", ruleValue)
+	}
+	return contains(fieldValue, ruleValue, o.Strict), nil
 }
 
 // NotInOperator checks if fieldValue is not in ruleValue array
-type NotInOperator struct{}
+type NotInOperator struct {
+	Strict bool
+}
 
 func (o NotInOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return !Contains(fieldValue, ruleValue)
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o NotInOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	if !isList(ruleValue) {
+		return false, valueMismatch("array", ruleValue)
+	}
+	return !contains(fieldValue, ruleValue, o.Strict), nil
 }
 
 // StartsWithOperator checks if fieldValue starts with ruleValue
 type StartsWithOperator struct{}
 
 func (o StartsWithOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return strings.HasPrefix(fieldValue.(string), ruleValue.(string))
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o StartsWithOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, value, err := stringOperands(fieldValue, ruleValue)
+	return err == nil && strings.HasPrefix(field, value), err
 }
 
 // EndsWithOperator checks if fieldValue ends with ruleValue
 type EndsWithOperator struct{}
 
 func (o EndsWithOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return strings.HasSuffix(fieldValue.(string), ruleValue.(string))
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o EndsWithOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, value, err := stringOperands(fieldValue, ruleValue)
+	return err == nil && strings.HasSuffix(field, value), err
 }
 
 // ContainsOperator checks if fieldValue contains ruleValue
 type ContainsOperator struct{}
 
 func (o ContainsOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return strings.Contains(fieldValue.(string), ruleValue.(string))
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o ContainsOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, value, err := stringOperands(fieldValue, ruleValue)
+	return err == nil && strings.Contains(field, value), err
 }
 
 // NotContainsOperator checks if fieldValue does not contains ruleValue
 type NotContainsOperator struct{}
 
 func (o NotContainsOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	return !strings.Contains(fieldValue.(string), ruleValue.(string))
+	result, _ := o.Check(fieldValue, ruleValue)
+	return result
+}
+
+func (o NotContainsOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, value, err := stringOperands(fieldValue, ruleValue)
+	return err == nil && !strings.Contains(field, value), err
 }
 
 // RegexOperator checks if fieldValue contains any match of the regular expression pattern
 type RegexOperator struct{}
 
 func (o RegexOperator) Apply(fieldValue, ruleValue interface{}) bool {
-	result, _ := regexp.MatchString(ruleValue.(string), fieldValue.(string))
+	result, _ := o.Check(fieldValue, ruleValue)
 	return result
 }
 
+func (o RegexOperator) Check(fieldValue, ruleValue interface{}) (bool, error) {
+	field, pattern, err := stringOperands(fieldValue, ruleValue)
+	if err != nil {
+		return false, err
+	}
+	result, err := regexp.MatchString(pattern, field)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid pattern: %w", ErrInvalidRules, err)
+	}
+	return result, nil
+}
+
+// stringOperands asserts both operands of a string operator are strings
+func stringOperands(fieldValue, ruleValue interface{}) (string, string, error) {
+	field, ok := fieldValue.(string)
+	if !ok {
+		return "", "", fieldMismatch("string", fieldValue)
+	}
+	value, ok := ruleValue.(string)
+	if !ok {
+		return "", "", valueMismatch("string", ruleValue)
+	}
+	return field, value, nil
+}
+
 // OperatorFactory to create operators based on string representation
 type OperatorFactory struct{}
 
 func (f OperatorFactory) Create(operator string) Operator {
-	switch operator {
-	case "equals":
-		return EqualsOperator{}
-	case "notEquals":
-		return NotEqualsOperator{}
-	case "greaterThan":
-		return GreaterThanOperator{}
-	case "lessThan":
-		return LessThanOperator{}
-	case "greaterThanInclusive":
-		return GreaterThanInclusiveOperator{}
-	case "lessThanInclusive":
-		return LessThanInclusiveOperator{}
-	case "in":
-		return InOperator{}
-	case "notIn":
-		return NotInOperator{}
-	case "startsWith":
-		return StartsWithOperator{}
-	case "endsWith":
-		return EndsWithOperator{}
-	case "contains":
-		return ContainsOperator{}
-	case "notContains":
-		return NotContainsOperator{}
-	case "regex":
-		return RegexOperator{}
-	default:
+	spec, exists := builtinRegistry.Lookup(operator)
+	if !exists {
 		return nil
 	}
+	return spec.Operator
 }
 
-// Rule represents a single condition
+// Rule represents a single condition, or a group of nested rules when it has no field
 type Rule struct {
-	Field    string      `json:"field"`
-	Operator string      `json:"operator"`
-	Value    interface{} `json:"value"`
+	Field    string      `json:"field,omitempty"`
+	Operator string      `json:"operator,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+
+	// All passes when every nested rule passes
+	All []Rule `json:"all,omitempty"`
+	// Any passes when at least one nested rule passes
+	Any []Rule `json:"any,omitempty"`
+	// None passes when no nested rule passes
+	None []Rule `json:"none,omitempty"`
+	// Not passes when the nested rule does not pass
+	Not *Rule `json:"not,omitempty"`
+
+	// Weight is added to the score of a rule set in scoring mode when the rule, or the group,
+	// passes
+	Weight float64 `json:"weight,omitempty"`
+
+	// Metadata describes the rule, a rule or a group outside its effective window is
+	// skipped as if it was not there
+	Metadata
 }
 
-// ConditionSet represents a set of conditions with All/Any logic
+// IsGroup reports whether the rule groups nested rules instead of checking a field
+func (r Rule) IsGroup() bool {
+	return r.Field == "" && r.Operator == "" && (r.All != nil || r.Any != nil || r.None != nil || r.Not != nil)
+}
+
+// ConditionSet represents a set of conditions with All/Any/None/Not logic, every
+// non-empty part of it has to pass
 type ConditionSet struct {
-	All []Rule `json:"all"`
-	Any []Rule `json:"any"`
+	All  []Rule `json:"all,omitempty"`
+	Any  []Rule `json:"any,omitempty"`
+	None []Rule `json:"none,omitempty"`
+	Not  *Rule  `json:"not,omitempty"`
+
+	// Weight is added to the score of a rule set in scoring mode when the condition set passes
+	Weight float64 `json:"weight,omitempty"`
 }
 
 // RuleSet represents the overall rule set with multiple condition sets
 type RuleSet struct {
+	// Metadata describes the rule set, outside its effective window the rule set does not pass
+	Metadata
 	Conditions []ConditionSet `json:"conditions"`
+
+	// Event and Actions are fired when the conditions pass
+	Event   Actions `json:"event,omitempty"`
+	Actions Actions `json:"actions,omitempty"`
+	// OnFailure is fired when the conditions do not pass
+	OnFailure Actions `json:"onFailure,omitempty"`
+
+	// Score ranks the rule set when it matches in an Engine using the HighestScore strategy,
+	// the computed score ranks a rule set in scoring mode instead
+	Score float64 `json:"score,omitempty"`
+	// Priority orders the rule set in an Engine when a Repository loads it, higher first
+	Priority int `json:"priority,omitempty"`
+
+	// Scoring evaluates the rule set in scoring mode when it is set
+	Scoring *Scoring `json:"scoring,omitempty"`
 }
 
 // contains checks if a value is in an array of either strings or integers
 func Contains(value, array interface{}) bool {
+	return contains(value, array, false)
+}
+
+func contains(value, array interface{}, strict bool) bool {
+	if !isList(array) {
+		return false
+	}
 	arr := reflect.ValueOf(array)
-	switch reflect.TypeOf(array).Kind() {
-	case reflect.Slice, reflect.Array:
-		for i := 0; i < arr.Len(); i++ {
-			if reflect.DeepEqual(arr.Index(i).Interface(), value) {
-				return true
-			}
+	for i := 0; i < arr.Len(); i++ {
+		if equals(arr.Index(i).Interface(), value, strict) {
+			return true
 		}
 	}
 	return false
 }
 
-// compare compares two interface{} values
-func compare(a, b interface{}) int {
-	switch a := a.(type) {
-	case float64:
-		b := b.(float64)
-		return compareValues(a, b)
-	case int:
-		b := b.(int)
-		return compareValues(a, b)
-	default:
-		return 0
+// equals compares two values, converting between numeric types unless strict is set
+func equals(a, b interface{}, strict bool) bool {
+	if strict {
+		return reflect.DeepEqual(a, b)
 	}
+	return valuesEqual(a, b)
+}
+
+// compare orders two numbers, or two strings. Numbers of any type, json.Number and numeric
+// strings are compared by value, in strict mode both operands must have the same type.
+func compare(a, b interface{}, strict bool) (int, error) {
+	_, aIsString := a.(string)
+	_, aIsNumber := toNumber(a, !strict)
+	if !aIsString && !aIsNumber {
+		return 0, fieldMismatch("number or string", a)
+	}
+	if strict && reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return 0, valueMismatch(typeName(a), b)
+	}
+
+	if x, y, ok := numbers(a, b, strict); ok {
+		return x.compare(y), nil
+	}
+	if aIsString {
+		if value, ok := b.(string); ok {
+			return compareValues(a.(string), value), nil
+		}
+		if !aIsNumber {
+			// a number is compared with a field that is not numeric
+			if _, ok := toNumber(b, false); ok {
+				return 0, fieldMismatch("number", a)
+			}
+			return 0, valueMismatch("string", b)
+		}
+	}
+	return 0, valueMismatch("number", b)
 }
 
 // compareValues compares two values of the same type
-func compareValues[T float64 | string | int](a, b T) int {
+func compareValues[T int | int64 | float64 | string](a, b T) int {
 	if a > b {
 		return 1
 	} else if a < b {
@@ -202,42 +374,9 @@ type RuleChecker struct {
 }
 
 func (rc RuleChecker) CheckRule(obj map[string]interface{}, rule Rule, custom map[string]CustomOperation) bool {
-	var fieldValue interface{}
-	var exists bool
-	if strings.HasPrefix(rule.Field, "external") {
-		fields := strings.Split(rule.Field, ".")
-		field := fields[1]
-
-		operation, exists := custom[field]
-		if !exists {
-			return false
-		}
-		fieldValue = operation.Execute(obj, rule.Field)
-	} else {
-		fieldValue, exists = obj[rule.Field]
-		if !exists {
-			return false
-		}
-	}
-
-	if strings.HasPrefix(rule.Operator, "custom") {
-		fields := strings.Split(rule.Operator, ".")
-		field := fields[1]
-
-		operation, exists := custom[field]
-		if !exists {
-			return false
-		}
-		fieldValue = operation.Execute(obj[rule.Field], rule.Value)
-
-		return fieldValue == true
-	} else {
-		operator := rc.OperatorFactory.Create(rule.Operator)
-		if operator == nil {
-			return false
-		}
-		return operator.Apply(fieldValue, rule.Value)
-	}
+	n, _ := compileNode(rule, "", &options{custom: custom, lenient: true})
+	result, _ := n.eval(&evaluation{ctx: context.Background(), program: &Program{lenient: true, windowed: true}, obj: obj, now: time.Now()}, nil)
+	return result
 }
 
 // ConditionSetChecker checks condition sets against an object
@@ -246,48 +385,9 @@ type ConditionSetChecker struct {
 }
 
 func (cc ConditionSetChecker) CheckConditionSet(obj map[string]interface{}, conditionSet ConditionSet, custom map[string]CustomOperation) bool {
-	allChan := make(chan bool)
-	anyChan := make(chan bool)
-
-	// Check "all" conditions in parallel
-	go func() {
-		for _, rule := range conditionSet.All {
-			if !cc.RuleChecker.CheckRule(obj, rule, custom) {
-				allChan <- false
-				close(allChan)
-				return
-			}
-		}
-		allChan <- true
-		close(allChan)
-	}()
-
-	// Check "any" conditions in parallel
-	go func() {
-		for _, rule := range conditionSet.Any {
-			if cc.RuleChecker.CheckRule(obj, rule, custom) {
-				anyChan <- true
-				close(anyChan)
-				return
-			}
-		}
-		anyChan <- false
-		close(anyChan)
-	}()
-
-	allPass := true
-	anyPass := false
-	if len(conditionSet.All) > 0 {
-		allPass = <-allChan
-	}
-
-	if len(conditionSet.Any) > 0 {
-		anyPass = <-anyChan
-	} else {
-		anyPass = true
-	}
-
-	return allPass && anyPass
+	group, _ := compileGroup(TraceConditionSet, conditionSet.All, conditionSet.Any, conditionSet.None, conditionSet.Not, "", &options{custom: custom, lenient: true})
+	result, _ := group.eval(&evaluation{ctx: context.Background(), program: &Program{lenient: true, windowed: true}, obj: obj, now: time.Now()}, nil)
+	return result
 }
 
 // RuleSetChecker checks rule sets against an object
@@ -296,6 +396,9 @@ type RuleSetChecker struct {
 }
 
 func (rsc RuleSetChecker) CheckRuleSet(obj map[string]interface{}, ruleSet RuleSet, custom map[string]CustomOperation) bool {
+	if !ruleSet.EffectiveAt(time.Now()) {
+		return false
+	}
 	for _, conditionSet := range ruleSet.Conditions {
 		if !rsc.ConditionSetChecker.CheckConditionSet(obj, conditionSet, custom) {
 			return false
@@ -306,35 +409,79 @@ func (rsc RuleSetChecker) CheckRuleSet(obj map[string]interface{}, ruleSet RuleS
 
 // Execute evaluates the ruleset based on the input data
 func Execute(input interface{}, rules string, custom map[string]CustomOperation) bool {
-	var objs map[string]interface{}
-
-	switch data := input.(type) {
-	case string:
-		// If input is JSON string, parse it
-		if err := json.Unmarshal([]byte(data), &objs); err != nil {
-			return false
-		}
-	case map[string]interface{}:
-		// If input is already a map, use it directly
-		objs = data
-	default:
+	objs, err := parseInput(input)
+	if err != nil {
 		return false
 	}
 
-	var ruleSet RuleSet
-	if err := json.Unmarshal([]byte(rules), &ruleSet); err != nil {
+	program, err := Compile(rules, WithCustom(custom), withLenient())
+	if err != nil {
 		return false
 	}
 
-	operatorFactory := OperatorFactory{}
-	ruleChecker := RuleChecker{OperatorFactory: operatorFactory}
-	conditionSetChecker := ConditionSetChecker{RuleChecker: ruleChecker}
-	ruleSetChecker := RuleSetChecker{ConditionSetChecker: conditionSetChecker}
-
-	return ruleSetChecker.CheckRuleSet(objs, ruleSet, custom)
+	result, _ := program.Eval(objs)
+	return result
 }
 
 // CustomOperation defines the interface for custom operations
 type CustomOperation interface {
 	Execute(input, value interface{}) interface{}
 }
+
+// ContextOperation is a CustomOperation that receives the context of the evaluation, e.g.
+// to pass its deadline to a database lookup. ExecuteContext is called instead of Execute,
+// an error fails the rule.
+type ContextOperation interface {
+	CustomOperation
+	ExecuteContext(ctx context.Context, input, value interface{}) (interface{}, error)
+}
+
+// Evaluate evaluates the ruleset based on the input data like Execute does,
+// but reports malformed rules and inputs as errors instead of a failed match
+func Evaluate(input interface{}, rules string, custom map[string]CustomOperation) (bool, error) {
+	return EvaluateContext(context.Background(), input, rules, custom)
+}
+
+// EvaluateContext evaluates the ruleset like Evaluate does, the evaluation stops with the
+// error of the context once it is cancelled or its deadline is exceeded
+func EvaluateContext(ctx context.Context, input interface{}, rules string, custom map[string]CustomOperation) (bool, error) {
+	objs, err := parseInput(input)
+	if err != nil {
+		return false, err
+	}
+
+	program, err := Compile(rules, WithCustom(custom))
+	if err != nil {
+		return false, err
+	}
+	return program.EvalContext(ctx, objs)
+}
+
+// parseInput converts a JSON string into the object rules are checked against. Maps, structs,
+// pointers to structs and FieldAccessors are used directly.
+func parseInput(input interface{}) (interface{}, error) {
+	switch data := input.(type) {
+	case string:
+		// If input is JSON string, parse it
+		var objs map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &objs); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		return objs, nil
+	case map[string]interface{}, FieldAccessor:
+		// If input is already a map, use it directly
+		return data, nil
+	}
+
+	value := reflect.ValueOf(input)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	switch {
+	case value.Kind() == reflect.Struct:
+		return input, nil
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+		return input, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type %T", ErrInvalidInput, input)
+}
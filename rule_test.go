@@ -1,7 +1,10 @@
 package rule
 
 import (
+	"errors"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestEqualsOperator(t *testing.T) {
@@ -181,12 +184,12 @@ func TestCheckRule(t *testing.T) {
 		rule     Rule
 		expected bool
 	}{
-		{Rule{"country", "equals", "Turkey"}, true},
-		{Rule{"country", "notEquals", "Germany"}, true},
-		{Rule{"age", "greaterThan", 25}, true},
-		{Rule{"age", "lessThan", 35}, true},
-		{Rule{"country", "in", []string{"Turkey", "Germany"}}, true},
-		{Rule{"country", "notIn", []string{"France", "Italy"}}, true},
+		{Rule{Field: "country", Operator: "equals", Value: "Turkey"}, true},
+		{Rule{Field: "country", Operator: "notEquals", Value: "Germany"}, true},
+		{Rule{Field: "age", Operator: "greaterThan", Value: 25}, true},
+		{Rule{Field: "age", Operator: "lessThan", Value: 35}, true},
+		{Rule{Field: "country", Operator: "in", Value: []string{"Turkey", "Germany"}}, true},
+		{Rule{Field: "country", Operator: "notIn", Value: []string{"France", "Italy"}}, true},
 	}
 
 	for _, test := range tests {
@@ -210,10 +213,10 @@ func TestCheckConditionSet(t *testing.T) {
 		conditionSet ConditionSet
 		expected     bool
 	}{
-		{ConditionSet{All: []Rule{{"country", "equals", "Turkey"}}, Any: []Rule{}}, true},
-		{ConditionSet{All: []Rule{{"country", "equals", "Germany"}}, Any: []Rule{}}, false},
-		{ConditionSet{All: []Rule{}, Any: []Rule{{"country", "equals", "Germany"}, {"country", "equals", "Turkey"}}}, true},
-		{ConditionSet{All: []Rule{}, Any: []Rule{{"country", "equals", "France"}}}, false},
+		{ConditionSet{All: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}}, Any: []Rule{}}, true},
+		{ConditionSet{All: []Rule{{Field: "country", Operator: "equals", Value: "Germany"}}, Any: []Rule{}}, false},
+		{ConditionSet{All: []Rule{}, Any: []Rule{{Field: "country", Operator: "equals", Value: "Germany"}, {Field: "country", Operator: "equals", Value: "Turkey"}}}, true},
+		{ConditionSet{All: []Rule{}, Any: []Rule{{Field: "country", Operator: "equals", Value: "France"}}}, false},
 	}
 
 	for _, test := range tests {
@@ -238,10 +241,10 @@ func TestCheckRuleSet(t *testing.T) {
 		ruleSet  RuleSet
 		expected bool
 	}{
-		{RuleSet{Conditions: []ConditionSet{{All: []Rule{{"country", "equals", "Turkey"}}, Any: []Rule{}}}}, true},
-		{RuleSet{Conditions: []ConditionSet{{All: []Rule{{"country", "equals", "Germany"}}, Any: []Rule{}}}}, false},
-		{RuleSet{Conditions: []ConditionSet{{All: []Rule{}, Any: []Rule{{"country", "equals", "Germany"}, {"country", "equals", "Turkey"}}}}}, true},
-		{RuleSet{Conditions: []ConditionSet{{All: []Rule{}, Any: []Rule{{"country", "equals", "France"}}}}}, false},
+		{RuleSet{Conditions: []ConditionSet{{All: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}}, Any: []Rule{}}}}, true},
+		{RuleSet{Conditions: []ConditionSet{{All: []Rule{{Field: "country", Operator: "equals", Value: "Germany"}}, Any: []Rule{}}}}, false},
+		{RuleSet{Conditions: []ConditionSet{{All: []Rule{}, Any: []Rule{{Field: "country", Operator: "equals", Value: "Germany"}, {Field: "country", Operator: "equals", Value: "Turkey"}}}}}, true},
+		{RuleSet{Conditions: []ConditionSet{{All: []Rule{}, Any: []Rule{{Field: "country", Operator: "equals", Value: "France"}}}}}, false},
 	}
 
 	for _, test := range tests {
@@ -681,3 +684,214 @@ func (o *CustomControl) Execute(input, value interface{}) interface{} {
 	//TODO: there should be some implementation here.
 	return true
 }
+
+func TestEvaluate(t *testing.T) {
+	input := `{
+		"country": "Turkey",
+		"population": 20000
+	}`
+
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"country",
+				   "operator":"equals",
+				   "value":"Turkey"
+				}
+			 ],
+			 "any":[
+				{
+				   "field":"population",
+				   "operator":"greaterThan",
+				   "value":30000
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	result, err := Evaluate(input, rules, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result {
+		t.Errorf("it is passed")
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	rule := func(field, operator string) string {
+		return `{"conditions":[{"all":[{"field":"country","operator":"equals","value":"Turkey"}],"any":[{"field":"` + field + `","operator":"` + operator + `","value":1}]}]}`
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		rules string
+		err   error
+		path  string
+	}{
+		{"invalid rules", `{}`, `{`, ErrInvalidRules, ""},
+		{"invalid input", `{`, rule("country", "equals"), ErrInvalidInput, ""},
+		{"unsupported input", 42, rule("country", "equals"), ErrInvalidInput, ""},
+		{"unknown operator", `{"country":"Turkey"}`, rule("country", "greaterthan"), ErrUnknownOperator, "conditions[0].any[0]"},
+		{"missing field", `{"country":"Turkey"}`, rule("population", "equals"), ErrMissingField, "conditions[0].any[0]"},
+		{"custom operator", `{"country":"Turkey"}`, rule("country", "custom.check"), ErrCustomOperationNotFound, "conditions[0].any[0]"},
+		{"custom input", `{"country":"Turkey"}`, rule("external.score", "equals"), ErrCustomOperationNotFound, "conditions[0].any[0]"},
+	}
+
+	for _, test := range tests {
+		result, err := Evaluate(test.input, test.rules, nil)
+		if result {
+			t.Errorf("%s: it is passed", test.name)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v; expected %v", test.name, err, test.err)
+		}
+
+		var ruleErr *RuleError
+		if errors.As(err, &ruleErr) != (test.path != "") {
+			t.Errorf("%s: error = %v; expected rule error %v", test.name, err, test.path != "")
+		} else if test.path != "" && ruleErr.Path != test.path {
+			t.Errorf("%s: path = %s; expected %s", test.name, ruleErr.Path, test.path)
+		}
+	}
+}
+
+func TestEvaluateIndependentOfOrder(t *testing.T) {
+	input := `{"a":"x"}`
+	missing := `{"field":"b","operator":"equals","value":1}`
+	tests := []struct {
+		part, other string
+		expected    bool
+		err         error
+	}{
+		// a broken rule does not decide a group another rule decides
+		{"any", `{"field":"a","operator":"equals","value":"x"}`, true, nil},
+		{"all", `{"field":"a","operator":"equals","value":"y"}`, false, nil},
+		{"none", `{"field":"a","operator":"equals","value":"x"}`, false, nil},
+		// the error is returned when no rule decides it
+		{"any", `{"field":"a","operator":"equals","value":"y"}`, false, ErrMissingField},
+		{"all", `{"field":"a","operator":"equals","value":"x"}`, false, ErrMissingField},
+	}
+
+	for _, test := range tests {
+		for _, rules := range []string{missing + "," + test.other, test.other + "," + missing} {
+			rules = `{"conditions":[{"` + test.part + `":[` + rules + `]}]}`
+			result, err := Evaluate(input, rules, nil)
+			if result != test.expected || !errors.Is(err, test.err) {
+				t.Errorf("Evaluate(%s) = %v, %v; expected %v, %v", rules, result, err, test.expected, test.err)
+			}
+			if Execute(input, rules, nil) != test.expected {
+				t.Errorf("Execute(%s) = %v; expected %v", rules, !test.expected, test.expected)
+			}
+		}
+	}
+}
+
+func TestOperatorsWithMismatchedTypes(t *testing.T) {
+	tests := []struct {
+		operator   CheckedOperator
+		fieldValue interface{}
+		ruleValue  interface{}
+		operand    string
+	}{
+		{StartsWithOperator{}, 5, "Tur", "field"},
+		{EndsWithOperator{}, "Turkey", 5, "value"},
+		{ContainsOperator{}, nil, "Tur", "field"},
+		{NotContainsOperator{}, []string{"Turkey"}, "Tur", "field"},
+		{RegexOperator{}, 5.5, "[A-z]ork", "field"},
+		{GreaterThanOperator{}, 5.5, "abc", "value"},
+		{LessThanOperator{}, 5, true, "value"},
+		{GreaterThanInclusiveOperator{}, true, 5, "field"},
+		{LessThanInclusiveOperator{}, nil, 5, "field"},
+		{InOperator{}, "Turkey", nil, "value"},
+		{NotInOperator{}, "Turkey", "Turkey", "value"},
+	}
+
+	for _, test := range tests {
+		if test.operator.Apply(test.fieldValue, test.ruleValue) {
+			t.Errorf("%T.Apply(%v, %v) = true; expected false", test.operator, test.fieldValue, test.ruleValue)
+		}
+
+		_, err := test.operator.Check(test.fieldValue, test.ruleValue)
+		var mismatch *TypeMismatchError
+		if !errors.As(err, &mismatch) || !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("%T.Check(%v, %v) error = %v; expected type mismatch", test.operator, test.fieldValue, test.ruleValue, err)
+		} else if mismatch.Operand != test.operand {
+			t.Errorf("%T.Check(%v, %v) operand = %s; expected %s", test.operator, test.fieldValue, test.ruleValue, mismatch.Operand, test.operand)
+		}
+	}
+}
+
+func TestEvaluateWithMismatchedTypes(t *testing.T) {
+	rules := `{"conditions":[{"all":[{"field":"population","operator":"startsWith","value":"20"}]}]}`
+
+	result, err := Evaluate(`{"population": 20000}`, rules, nil)
+	if result {
+		t.Errorf("it is passed")
+	}
+
+	var mismatch *TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("error = %v; expected type mismatch", err)
+	}
+	expected := TypeMismatchError{Field: "population", Operator: "startsWith", Operand: "field", Expected: "string", Actual: "float64"}
+	if *mismatch != expected {
+		t.Errorf("mismatch = %+v; expected %+v", *mismatch, expected)
+	}
+
+	if Execute(`{"population": 20000}`, rules, nil) {
+		t.Errorf("it is passed")
+	}
+}
+
+func TestCheckConditionSetWithNoneAndNot(t *testing.T) {
+	obj := map[string]interface{}{
+		"country": "Turkey",
+		"age":     30,
+	}
+
+	ruleChecker := RuleChecker{OperatorFactory: OperatorFactory{}}
+	conditionSetChecker := ConditionSetChecker{RuleChecker: ruleChecker}
+
+	tests := []struct {
+		conditionSet ConditionSet
+		expected     bool
+	}{
+		{ConditionSet{None: []Rule{{Field: "country", Operator: "equals", Value: "Germany"}}}, true},
+		{ConditionSet{None: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}}}, false},
+		{ConditionSet{Not: &Rule{Field: "age", Operator: "lessThan", Value: 18}}, true},
+		{ConditionSet{Not: &Rule{Any: []Rule{{Field: "age", Operator: "lessThan", Value: 18}, {Field: "country", Operator: "equals", Value: "Turkey"}}}}, false},
+	}
+
+	for _, test := range tests {
+		result := conditionSetChecker.CheckConditionSet(obj, test.conditionSet, nil)
+		if result != test.expected {
+			t.Errorf("CheckConditionSet(%v, %v) = %v; expected %v", obj, test.conditionSet, result, test.expected)
+		}
+	}
+}
+
+func TestCheckConditionSetDoesNotLeakGoroutines(t *testing.T) {
+	obj := map[string]interface{}{
+		"country": "Turkey",
+	}
+	conditionSetChecker := ConditionSetChecker{}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		conditionSetChecker.CheckConditionSet(obj, ConditionSet{All: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}}}, nil)
+		conditionSetChecker.CheckConditionSet(obj, ConditionSet{Any: []Rule{{Field: "country", Operator: "equals", Value: "Turkey"}}}, nil)
+	}
+	// goroutines that were started can take a while to exit
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines = %d after checking condition sets; expected %d", after, before)
+	}
+}
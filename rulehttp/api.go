@@ -0,0 +1,67 @@
+package rulehttp
+
+import "github.com/nurettintopal/rule"
+
+// EvaluateRequest is the body of the evaluate endpoints
+type EvaluateRequest struct {
+	// Input is the object the rules are evaluated against
+	Input map[string]interface{} `json:"input"`
+	// Explain asks for the trace of every evaluated rule set
+	Explain bool `json:"explain,omitempty"`
+}
+
+// EvaluateResponse is the outcome of evaluating an input against every rule set
+type EvaluateResponse struct {
+	// Matches are the rule sets selected by the strategy of the engine
+	Matches []rule.Match `json:"matches"`
+	// Errors are the rule sets that could not be evaluated
+	Errors []RuleSetError `json:"errors,omitempty"`
+	// Traces are the traces of the rule sets by id, when they were asked for
+	Traces map[string]*rule.Trace `json:"traces,omitempty"`
+}
+
+// RuleSetResponse is the outcome of evaluating an input against a single rule set
+type RuleSetResponse struct {
+	ID      string        `json:"id"`
+	Passed  bool          `json:"passed"`
+	Skipped bool          `json:"skipped,omitempty"`
+	Actions []rule.Action `json:"actions,omitempty"`
+	// Score and Contributions are set for rule sets in scoring mode
+	Score         float64             `json:"score,omitempty"`
+	Contributions []rule.Contribution `json:"contributions,omitempty"`
+	Trace         *rule.Trace         `json:"trace,omitempty"`
+}
+
+// RuleSetError is a rule set that could not be evaluated
+type RuleSetError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// RuleSetInfo describes a loaded rule set
+type RuleSetInfo struct {
+	ID       string `json:"id"`
+	Priority int    `json:"priority"`
+	// RuleSet is the rule set itself, it is only returned for a single rule set
+	RuleSet *rule.RuleSet `json:"ruleSet,omitempty"`
+}
+
+// ListResponse is the list of the loaded rule sets, in the order they are evaluated
+type ListResponse struct {
+	RuleSets []RuleSetInfo `json:"ruleSets"`
+}
+
+// ValidateResponse is the outcome of validating a rule document
+type ValidateResponse struct {
+	// Valid is false when the document has errors, warnings do not make it invalid
+	Valid       bool             `json:"valid"`
+	Diagnostics rule.Diagnostics `json:"diagnostics"`
+	// Line and Column locate the error of a document that could not be parsed
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// ErrorResponse is the body of every response with an error status
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,307 @@
+// Package rulehttp serves the rule sets of a rule.Engine over HTTP, so services written in
+// other languages can use the same rules. The endpoints take and return JSON:
+//
+//	GET  /rulesets                list the rule sets, ListResponse
+//	GET  /rulesets/{id}           a rule set and its rules, RuleSetInfo
+//	POST /evaluate                evaluate an EvaluateRequest against every rule set, EvaluateResponse
+//	POST /rulesets/{id}/evaluate  evaluate an EvaluateRequest against a rule set, RuleSetResponse
+//	POST /validate                validate the rule document of the body, ValidateResponse
+//	GET  /healthz                 report the handler is serving
+//
+// Errors are ErrorResponses with a 4xx or 5xx status.
+package rulehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nurettintopal/rule"
+)
+
+// DefaultMaxBodyBytes is the largest request body a Handler reads unless WithMaxBodyBytes is given
+const DefaultMaxBodyBytes = 1 << 20
+
+// Handler serves the rule sets of an engine, it is safe for concurrent use
+type Handler struct {
+	engine       *rule.Engine
+	opts         []rule.Option
+	maxBodyBytes int64
+	mux          *http.ServeMux
+}
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithRuleOptions sets the options rule documents are validated with, they should be the
+// options the rule sets of the engine are compiled with
+func WithRuleOptions(opts ...rule.Option) Option {
+	return func(h *Handler) {
+		h.opts = opts
+	}
+}
+
+// WithMaxBodyBytes limits the size of request bodies, larger requests are rejected
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodyBytes = n
+	}
+}
+
+// NewHandler returns a handler serving the rule sets of the engine
+func NewHandler(engine *rule.Engine, opts ...Option) *Handler {
+	h := &Handler{engine: engine, maxBodyBytes: DefaultMaxBodyBytes, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /rulesets", h.list)
+	h.mux.HandleFunc("GET /rulesets/{id}", h.get)
+	h.mux.HandleFunc("POST /evaluate", h.evaluate)
+	h.mux.HandleFunc("POST /rulesets/{id}/evaluate", h.evaluateRuleSet)
+	h.mux.HandleFunc("POST /validate", h.validate)
+	h.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, pattern := h.mux.Handler(r)
+	if pattern == "" {
+		// the mux answers unknown paths and methods in plain text, keep its status only
+		status := &statusWriter{ResponseWriter: w, status: http.StatusNotFound}
+		handler.ServeHTTP(status, r)
+		writeError(w, status.status, errors.New(strings.ToLower(http.StatusText(status.status))))
+		return
+	}
+	// the mux sets the path values the handlers read
+	h.mux.ServeHTTP(w, r)
+}
+
+// statusWriter records the status of a response and drops its body
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	response := ListResponse{RuleSets: []RuleSetInfo{}}
+	for _, entry := range h.engine.Entries() {
+		response.RuleSets = append(response.RuleSets, RuleSetInfo{ID: entry.ID, Priority: entry.Priority})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	entry, exists := h.engine.Entry(r.PathValue("id"))
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("rule set %q not found", r.PathValue("id")))
+		return
+	}
+	ruleSet := entry.Program.RuleSet()
+	writeJSON(w, http.StatusOK, RuleSetInfo{ID: entry.ID, Priority: entry.Priority, RuleSet: &ruleSet})
+}
+
+func (h *Handler) evaluate(w http.ResponseWriter, r *http.Request) {
+	request, ok := h.decodeEvaluate(w, r)
+	if !ok {
+		return
+	}
+
+	var matches []rule.Match
+	var traces map[string]*rule.Trace
+	var err error
+	if request.Explain {
+		matches, traces, err = h.engine.RunExplainContext(r.Context(), request.Input)
+	} else {
+		matches, err = h.engine.RunContext(r.Context(), request.Input)
+	}
+	if ctxErr := r.Context().Err(); ctxErr != nil {
+		writeError(w, http.StatusServiceUnavailable, ctxErr)
+		return
+	}
+	response := EvaluateResponse{Matches: matches, Errors: ruleSetErrors(err), Traces: traces}
+	if response.Matches == nil {
+		response.Matches = []rule.Match{}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) evaluateRuleSet(w http.ResponseWriter, r *http.Request) {
+	entry, exists := h.engine.Entry(r.PathValue("id"))
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("rule set %q not found", r.PathValue("id")))
+		return
+	}
+	request, ok := h.decodeEvaluate(w, r)
+	if !ok {
+		return
+	}
+
+	var result rule.Result
+	var trace *rule.Trace
+	var err error
+	if request.Explain {
+		result, trace, err = entry.Program.RunExplainContext(r.Context(), request.Input)
+	} else {
+		result, err = entry.Program.RunContext(r.Context(), request.Input)
+	}
+	if ctxErr := r.Context().Err(); ctxErr != nil {
+		writeError(w, http.StatusServiceUnavailable, ctxErr)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	response := RuleSetResponse{
+		ID:            entry.ID,
+		Passed:        result.Passed,
+		Skipped:       result.Skipped,
+		Actions:       result.Actions,
+		Score:         result.Score,
+		Contributions: result.Contributions,
+		Trace:         trace,
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) validate(w http.ResponseWriter, r *http.Request) {
+	format, err := requestFormat(r)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	if err != nil {
+		writeError(w, bodyErrorStatus(err), err)
+		return
+	}
+
+	ruleSet, err := rule.ParseRuleSet(data, format)
+	if err != nil {
+		response := ValidateResponse{Diagnostics: rule.Diagnostics{{Severity: rule.SeverityError, Message: err.Error()}}}
+		var sourceErr *rule.SourceError
+		if errors.As(err, &sourceErr) {
+			response.Diagnostics[0].Path = sourceErr.Path
+			response.Line, response.Column = sourceErr.Line, sourceErr.Column
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	diagnostics := rule.Validate(ruleSet, h.opts...)
+	if diagnostics == nil {
+		diagnostics = rule.Diagnostics{}
+	}
+	writeJSON(w, http.StatusOK, ValidateResponse{Valid: !diagnostics.HasErrors(), Diagnostics: diagnostics})
+}
+
+// requestFormat returns the format of a rule document from the format query parameter or
+// the content type of the request, JSON by default
+func requestFormat(r *http.Request) (rule.Format, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return rule.Format(format), nil
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return rule.FormatJSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	switch mediaType {
+	case "application/json":
+		return rule.FormatJSON, nil
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return rule.FormatYAML, nil
+	case "application/toml":
+		return rule.FormatTOML, nil
+	case "text/plain":
+		return rule.FormatExpression, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", mediaType)
+}
+
+// decodeEvaluate reads the body of the evaluate endpoints
+func (h *Handler) decodeEvaluate(w http.ResponseWriter, r *http.Request) (EvaluateRequest, bool) {
+	var request EvaluateRequest
+	if !h.decode(w, r, &request) {
+		return request, false
+	}
+	if request.Input == nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid request body: the input is missing"))
+		return request, false
+	}
+	return request, true
+}
+
+// decode reads a JSON request body, numbers are decoded as float64 like the inputs of
+// rule.Evaluate so strict comparisons with the numbers of the rules hold. It writes the error
+// response and returns false when the body is invalid.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		writeError(w, bodyErrorStatus(err), fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// bodyErrorStatus is the status of an error reading a request body
+func bodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// ruleSetErrors converts the joined RuleSetErrors of an engine to their JSON form
+func ruleSetErrors(err error) []RuleSetError {
+	if err == nil {
+		return nil
+	}
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+
+	var ruleSetErrs []RuleSetError
+	for _, err := range errs {
+		var ruleSetErr *rule.RuleSetError
+		if errors.As(err, &ruleSetErr) {
+			ruleSetErrs = append(ruleSetErrs, RuleSetError{ID: ruleSetErr.ID, Error: ruleSetErr.Err.Error()})
+		} else {
+			ruleSetErrs = append(ruleSetErrs, RuleSetError{Error: err.Error()})
+		}
+	}
+	return ruleSetErrs
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,217 @@
+package rulehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nurettintopal/rule"
+)
+
+func newTestHandler(t *testing.T, opts ...Option) http.Handler {
+	engine := rule.NewEngine(rule.AllMatches)
+	ruleSets := map[string]string{
+		"gold":  `{"conditions":[{"all":[{"field":"tier","operator":"equals","value":"gold"}]}],"event":{"type":"fee","params":{"percent":1}}}`,
+		"large": `{"conditions":[{"all":[{"field":"total","operator":"greaterThan","value":1000}]}]}`,
+	}
+	priorities := map[string]int{"gold": 10, "large": 5}
+	for id, rules := range ruleSets {
+		if err := engine.Add(id, priorities[id], rules); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return NewHandler(engine, opts...)
+}
+
+// serve sends a request to the handler and decodes the JSON response
+func serve(t *testing.T, h http.Handler, method, target, contentType, body string, response interface{}) int {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("%s %s: Content-Type = %q; expected JSON", method, target, got)
+	}
+	if response != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, target, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestList(t *testing.T) {
+	h := newTestHandler(t)
+
+	var list ListResponse
+	if status := serve(t, h, "GET", "/rulesets", "", "", &list); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(list.RuleSets) != 2 || list.RuleSets[0].ID != "gold" || list.RuleSets[0].Priority != 10 || list.RuleSets[0].RuleSet != nil {
+		t.Errorf("list = %+v; expected the rule sets by priority", list)
+	}
+
+	var info RuleSetInfo
+	if status := serve(t, h, "GET", "/rulesets/large", "", "", &info); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if info.RuleSet == nil || info.RuleSet.Conditions[0].All[0].Field != "total" {
+		t.Errorf("info = %+v; expected the rules", info)
+	}
+
+	var errResponse ErrorResponse
+	if status := serve(t, h, "GET", "/rulesets/missing", "", "", &errResponse); status != http.StatusNotFound || errResponse.Error == "" {
+		t.Errorf("status = %d, %+v; expected not found", status, errResponse)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	h := newTestHandler(t)
+
+	var response EvaluateResponse
+	status := serve(t, h, "POST", "/evaluate", "application/json", `{"input": {"tier": "gold", "total": 5000}}`, &response)
+	if status != http.StatusOK || len(response.Matches) != 2 || response.Matches[0].ID != "gold" || response.Traces != nil {
+		t.Errorf("evaluate = %d, %+v; expected both rule sets to match", status, response)
+	}
+	if len(response.Matches[0].Actions) != 1 || response.Matches[0].Actions[0].Type != "fee" {
+		t.Errorf("matches = %+v; expected the fired actions", response.Matches)
+	}
+
+	response = EvaluateResponse{}
+	status = serve(t, h, "POST", "/evaluate", "application/json", `{"input": {"tier": "silver"}, "explain": true}`, &response)
+	if status != http.StatusOK || len(response.Matches) != 0 {
+		t.Fatalf("evaluate = %d, %+v; expected no match", status, response)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].ID != "large" || !strings.Contains(response.Errors[0].Error, "missing field") {
+		t.Errorf("errors = %+v; expected the missing field of the large rule set", response.Errors)
+	}
+	if len(response.Traces) != 2 || response.Traces["gold"].Result || response.Traces["large"].Children[0].Children[0].Children[0].Error == "" {
+		t.Errorf("traces = %+v; expected the trace of every rule set", response.Traces)
+	}
+}
+
+// countingOperation is a custom operation that counts its evaluations
+type countingOperation struct {
+	calls int
+}
+
+func (o *countingOperation) Execute(input, value interface{}) interface{} {
+	o.calls++
+	return input == value
+}
+
+func TestEvaluateWithFirstMatch(t *testing.T) {
+	count := &countingOperation{}
+	engine := rule.NewEngine(rule.FirstMatch, rule.WithStrictTypes(), rule.WithCustom(map[string]rule.CustomOperation{"count": count}))
+	ruleSets := []struct {
+		id       string
+		priority int
+		rules    string
+	}{
+		{"exact", 10, `{"conditions":[{"all":[{"field":"total","operator":"equals","value":5000},{"field":"tier","operator":"custom.count","value":"gold"}]}]}`},
+		{"large", 5, `{"conditions":[{"all":[{"field":"total","operator":"greaterThan","value":1000}]}]}`},
+	}
+	for _, ruleSet := range ruleSets {
+		if err := engine.Add(ruleSet.id, ruleSet.priority, ruleSet.rules); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	h := NewHandler(engine)
+
+	// numbers of the input compare strictly with the numbers of the rules
+	var response EvaluateResponse
+	status := serve(t, h, "POST", "/evaluate", "application/json", `{"input": {"tier": "gold", "total": 5000}, "explain": true}`, &response)
+	if status != http.StatusOK || len(response.Matches) != 1 || response.Matches[0].ID != "exact" {
+		t.Fatalf("evaluate = %d, %+v; expected the exact rule set to match", status, response)
+	}
+	// the traces come from the evaluation of the response, the large rule set is not evaluated
+	if len(response.Traces) != 1 || response.Traces["exact"] == nil || !response.Traces["exact"].Result {
+		t.Errorf("traces = %+v; expected the trace of the exact rule set only", response.Traces)
+	}
+	if count.calls != 1 {
+		t.Errorf("custom operation calls = %d; expected 1", count.calls)
+	}
+
+	var ruleSetResponse RuleSetResponse
+	status = serve(t, h, "POST", "/rulesets/exact/evaluate", "application/json", `{"input": {"tier": "gold", "total": 5000}, "explain": true}`, &ruleSetResponse)
+	if status != http.StatusOK || !ruleSetResponse.Passed || ruleSetResponse.Trace == nil || !ruleSetResponse.Trace.Result || count.calls != 2 {
+		t.Errorf("evaluate = %d, %+v, %d calls; expected the rule set to pass once with a trace", status, ruleSetResponse, count.calls)
+	}
+}
+
+func TestEvaluateRuleSet(t *testing.T) {
+	h := newTestHandler(t)
+
+	var response RuleSetResponse
+	status := serve(t, h, "POST", "/rulesets/large/evaluate", "application/json", `{"input": {"total": 12345678901234567890}, "explain": true}`, &response)
+	if status != http.StatusOK || !response.Passed || response.ID != "large" || response.Trace == nil {
+		t.Errorf("evaluate = %d, %+v; expected the rule set to pass with a trace", status, response)
+	}
+
+	var errResponse ErrorResponse
+	if status := serve(t, h, "POST", "/rulesets/large/evaluate", "application/json", `{"input": {}}`, &errResponse); status != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, %+v; expected the missing field to be unprocessable", status, errResponse)
+	}
+	if status := serve(t, h, "POST", "/rulesets/missing/evaluate", "application/json", `{"input": {}}`, nil); status != http.StatusNotFound {
+		t.Errorf("status = %d; expected not found", status)
+	}
+}
+
+func TestEvaluateBadRequests(t *testing.T) {
+	h := newTestHandler(t, WithMaxBodyBytes(64))
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `{"input": `, http.StatusBadRequest},
+		{"missing input", `{}`, http.StatusBadRequest},
+		{"unknown field", `{"input": {}, "explian": true}`, http.StatusBadRequest},
+		{"too large", `{"input": {"tier": "` + strings.Repeat("x", 100) + `"}}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errResponse ErrorResponse
+			if status := serve(t, h, "POST", "/evaluate", "application/json", tc.body, &errResponse); status != tc.status || errResponse.Error == "" {
+				t.Errorf("status = %d, %+v; expected %d", status, errResponse, tc.status)
+			}
+		})
+	}
+
+	if status := serve(t, h, "GET", "/evaluate", "", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /evaluate = %d; expected method not allowed", status)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	h := newTestHandler(t)
+
+	var response ValidateResponse
+	status := serve(t, h, "POST", "/validate", "application/yaml", "conditions:\n  - all:\n      - {field: a, operator: nope, value: 1}\n", &response)
+	if status != http.StatusOK || response.Valid || len(response.Diagnostics) != 1 || response.Diagnostics[0].Path != "conditions[0].all[0]" {
+		t.Errorf("validate = %d, %+v; expected the unknown operator", status, response)
+	}
+
+	response = ValidateResponse{}
+	status = serve(t, h, "POST", "/validate?format=expression", "", `a == 1 and a == 1`, &response)
+	if status != http.StatusOK || !response.Valid || len(response.Diagnostics) != 1 || response.Diagnostics[0].Severity != rule.SeverityWarning {
+		t.Errorf("validate = %d, %+v; expected a valid document with a warning", status, response)
+	}
+
+	response = ValidateResponse{}
+	status = serve(t, h, "POST", "/validate", "application/json", "{\n  \"conditions\": [\n", &response)
+	if status != http.StatusOK || response.Valid || response.Line == 0 {
+		t.Errorf("validate = %d, %+v; expected the location of the syntax error", status, response)
+	}
+
+	if status := serve(t, h, "POST", "/validate", "image/png", "", nil); status != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d; expected an unsupported media type", status)
+	}
+}
@@ -0,0 +1,439 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema describes the input rules are checked against, or one of its values. Pass it to
+// Compile with WithSchema to reject rules referring to unknown fields or comparing a field
+// with a value of another type.
+type Schema struct {
+	Type Type `json:"type"`
+	// Nullable allows the value to be null
+	Nullable bool `json:"nullable,omitempty"`
+	// Enum lists the values the value can have, empty allows any value of the type
+	Enum []interface{} `json:"enum,omitempty"`
+	// Fields describes the fields of an object, an object without Fields can have any field
+	Fields map[string]*Schema `json:"fields,omitempty"`
+	// Items describes the elements of an array, or the values of an object without Fields
+	Items *Schema `json:"items,omitempty"`
+}
+
+// anySchema describes a value that can be anything
+var anySchema = &Schema{Type: TypeAny, Nullable: true}
+
+// WithSchema checks the field and the value of every rule against the schema of the input
+func WithSchema(schema *Schema) Option {
+	return func(o *options) {
+		o.schema = schema
+	}
+}
+
+// lookup returns the schema of the values a field path selects
+func (s *Schema) lookup(path fieldPath) (*Schema, error) {
+	// an exact top-level key wins, like when the path is resolved
+	if field, exists := s.Fields[path.raw]; exists {
+		return field, nil
+	}
+
+	current := s
+	for i, segment := range path.segments {
+		if current.Type == TypeAny {
+			return anySchema, nil
+		}
+		switch segment.kind {
+		case segmentKey:
+			if current.Type != TypeObject {
+				return nil, fmt.Errorf("%w %q: %s is not an object", ErrUnknownField, path.raw, describePrefix(path, i))
+			}
+			if current.Fields == nil {
+				current = current.itemsOrAny()
+				continue
+			}
+			next, exists := current.Fields[segment.key]
+			if !exists {
+				return nil, fmt.Errorf("%w %q%s", ErrUnknownField, path.raw, suggest(segment.key, current.Fields))
+			}
+			current = next
+		case segmentIndex:
+			if current.Type != TypeArray {
+				return nil, fmt.Errorf("%w %q: %s is not an array", ErrUnknownField, path.raw, describePrefix(path, i))
+			}
+			current = current.itemsOrAny()
+		case segmentWildcard:
+			if current.Type != TypeArray && current.Type != TypeObject {
+				return nil, fmt.Errorf("%w %q: %s is not an array or an object", ErrUnknownField, path.raw, describePrefix(path, i))
+			}
+			if current.Type == TypeObject && current.Fields != nil {
+				return anySchema, nil
+			}
+			current = current.itemsOrAny()
+		}
+	}
+	return current, nil
+}
+
+func (s *Schema) itemsOrAny() *Schema {
+	if s.Items == nil {
+		return anySchema
+	}
+	return s.Items
+}
+
+// describePrefix names the part of a path before the segment at index, for error messages
+func describePrefix(path fieldPath, index int) string {
+	if index == 0 {
+		return "the input"
+	}
+	var prefix strings.Builder
+	for _, segment := range path.segments[:index] {
+		switch segment.kind {
+		case segmentKey:
+			if prefix.Len() > 0 {
+				prefix.WriteByte('.')
+			}
+			prefix.WriteString(segment.key)
+		case segmentIndex:
+			fmt.Fprintf(&prefix, "[%d]", segment.index)
+		case segmentWildcard:
+			prefix.WriteString("[*]")
+		}
+	}
+	return fmt.Sprintf("%q", prefix.String())
+}
+
+// suggest returns a hint naming the field closest to an unknown key, if any is close enough
+func suggest(key string, fields map[string]*Schema) string {
+	best, bestDistance := "", 3
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if distance := editDistance(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// check checks the operator of a rule accepts the field, and the rule value can be compared
+// with it
+func (s *Schema) check(rule Rule, spec OperatorSpec, strict bool) error {
+	if !s.compatible(spec.FieldTypes) {
+		mismatch := &TypeMismatchError{Field: rule.Field, Operator: rule.Operator, Operand: "field", Expected: describeTypes(spec.FieldTypes), Actual: s.describe()}
+		return invalidRules(mismatch)
+	}
+
+	switch spec.Compares {
+	case CompareValue:
+		return s.checkValue(rule, rule.Value, strict)
+	case CompareElements:
+		if !isList(rule.Value) {
+			return nil
+		}
+		list := reflect.ValueOf(rule.Value)
+		for i := 0; i < list.Len(); i++ {
+			if err := s.checkValue(rule, list.Index(i).Interface(), strict); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkValue checks a value of a rule is of the type of the field and one of its enum values
+func (s *Schema) checkValue(rule Rule, value interface{}, strict bool) error {
+	if !s.accepts(value, strict) {
+		return invalidRules(locateMismatch(valueMismatch(s.describe(), value), rule))
+	}
+	if len(s.Enum) == 0 || value == nil {
+		return nil
+	}
+	for _, allowed := range s.Enum {
+		if equals(allowed, value, strict) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: value %v is not one of %v", ErrInvalidRules, value, s.Enum)
+}
+
+// compatible reports whether values of the schema can be of one of the types, no types
+// accept anything
+func (s *Schema) compatible(types []Type) bool {
+	if len(types) == 0 || s.Type == TypeAny {
+		return true
+	}
+	for _, t := range types {
+		switch {
+		case t == s.Type, t == TypeAny:
+			return true
+		// strings and numbers are parsed as times
+		case t == TypeTime && (s.Type == TypeString || s.Type == TypeNumber):
+			return true
+		}
+	}
+	return false
+}
+
+// accepts reports whether a rule value can be compared with values of the schema
+func (s *Schema) accepts(value interface{}, strict bool) bool {
+	if value == nil {
+		return s.Nullable || s.Type == TypeNull || s.Type == TypeAny
+	}
+	switch s.Type {
+	case TypeAny:
+		return true
+	case TypeNumber:
+		_, ok := toNumber(value, !strict)
+		return ok
+	}
+	return s.Type.Accepts(value)
+}
+
+// describe names the type of the schema for error messages
+func (s *Schema) describe() string {
+	if s.Nullable && s.Type != TypeNull && s.Type != TypeAny {
+		return string(s.Type) + " or null"
+	}
+	return string(s.Type)
+}
+
+// jsonSchema is the part of a JSON Schema document a Schema is built from
+type jsonSchema struct {
+	Type        interface{}            `json:"type"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Items       *jsonSchema            `json:"items"`
+	Enum        []interface{}          `json:"enum"`
+	Nullable    bool                   `json:"nullable"`
+	Ref         string                 `json:"$ref"`
+	Defs        map[string]*jsonSchema `json:"$defs"`
+	Definitions map[string]*jsonSchema `json:"definitions"`
+}
+
+// SchemaFromJSONSchema builds a schema from a JSON Schema document. It uses the type,
+// properties, items, enum and nullable keywords, and local "$ref"s to "$defs" or
+// "definitions". The properties of an object are the only fields it can have.
+func SchemaFromJSONSchema(data []byte) (*Schema, error) {
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("rule: invalid JSON Schema: %w", err)
+	}
+	c := &schemaConverter{root: &root, refs: map[string]*Schema{}}
+	schema, err := c.convert(&root)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != TypeObject && schema.Type != TypeAny {
+		return nil, fmt.Errorf("rule: invalid JSON Schema: the input must be an object, not %s", schema.Type)
+	}
+	return schema, nil
+}
+
+// schemaConverter converts the schemas of a JSON Schema document, sharing the schemas of refs
+type schemaConverter struct {
+	root *jsonSchema
+	refs map[string]*Schema
+}
+
+func (c *schemaConverter) convert(js *jsonSchema) (*Schema, error) {
+	if js == nil {
+		return anySchema, nil
+	}
+	if js.Ref != "" {
+		return c.resolve(js.Ref)
+	}
+
+	s := &Schema{Type: TypeAny, Enum: js.Enum, Nullable: js.Nullable}
+	var types []string
+	switch t := js.Type.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("rule: invalid JSON Schema type %v", js.Type)
+			}
+			types = append(types, name)
+		}
+	case nil:
+		switch {
+		case js.Properties != nil:
+			types = []string{"object"}
+		case js.Items != nil:
+			types = []string{"array"}
+		}
+	default:
+		return nil, fmt.Errorf("rule: invalid JSON Schema type %v", js.Type)
+	}
+
+	var nonNull []Type
+	for _, name := range types {
+		switch name {
+		case "null":
+			s.Nullable = true
+		case "string":
+			nonNull = append(nonNull, TypeString)
+		case "number", "integer":
+			nonNull = append(nonNull, TypeNumber)
+		case "boolean":
+			nonNull = append(nonNull, TypeBool)
+		case "array":
+			nonNull = append(nonNull, TypeArray)
+		case "object":
+			nonNull = append(nonNull, TypeObject)
+		default:
+			return nil, fmt.Errorf("rule: invalid JSON Schema type %q", name)
+		}
+	}
+	switch {
+	case len(nonNull) == 1:
+		s.Type = nonNull[0]
+	case len(nonNull) == 0 && s.Nullable && len(types) > 0:
+		s.Type = TypeNull
+	}
+
+	if s.Type == TypeObject && js.Properties != nil {
+		s.Fields = make(map[string]*Schema, len(js.Properties))
+		for name, property := range js.Properties {
+			field, err := c.convert(property)
+			if err != nil {
+				return nil, err
+			}
+			s.Fields[name] = field
+		}
+	}
+	if s.Type == TypeArray && js.Items != nil {
+		items, err := c.convert(js.Items)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	}
+	return s, nil
+}
+
+// resolve converts the schema a local ref points to, once, so recursive schemas end
+func (c *schemaConverter) resolve(ref string) (*Schema, error) {
+	if s, exists := c.refs[ref]; exists {
+		return s, nil
+	}
+	var target *jsonSchema
+	switch {
+	case strings.HasPrefix(ref, "#/$defs/"):
+		target = c.root.Defs[strings.TrimPrefix(ref, "#/$defs/")]
+	case strings.HasPrefix(ref, "#/definitions/"):
+		target = c.root.Definitions[strings.TrimPrefix(ref, "#/definitions/")]
+	case ref == "#":
+		target = c.root
+	}
+	if target == nil {
+		return nil, fmt.Errorf("rule: unsupported JSON Schema $ref %q", ref)
+	}
+
+	s := &Schema{}
+	c.refs[ref] = s
+	converted, err := c.convert(target)
+	if err != nil {
+		return nil, err
+	}
+	*s = *converted
+	return s, nil
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+)
+
+// SchemaOf builds a schema from a Go struct, naming its fields like rules evaluated
+// against the struct do, by their rule or json tags.
+// Pointers, slices and maps are nullable, time.Time fields are times.
+func SchemaOf(v interface{}) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Struct && t.Kind() != reflect.Map) {
+		return nil, fmt.Errorf("rule: the schema of %T is not an object", v)
+	}
+	return schemaOfType(t, map[reflect.Type]*Schema{}), nil
+}
+
+// schemaOfType builds the schema of a Go type, seen holds the structs being built so
+// recursive types end
+func schemaOfType(t reflect.Type, seen map[reflect.Type]*Schema) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: TypeTime, Nullable: nullable}
+	case t == jsonNumberType:
+		return &Schema{Type: TypeNumber, Nullable: nullable}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: TypeString, Nullable: nullable}
+	case reflect.Bool:
+		return &Schema{Type: TypeBool, Nullable: nullable}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &Schema{Type: TypeNumber, Nullable: nullable}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// bytes are encoded as base64 strings
+			return &Schema{Type: TypeString, Nullable: true}
+		}
+		return &Schema{Type: TypeArray, Nullable: t.Kind() == reflect.Slice || nullable, Items: schemaOfType(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: TypeObject, Nullable: true, Items: schemaOfType(t.Elem(), seen)}
+	case reflect.Struct:
+		if s, exists := seen[t]; exists {
+			return s
+		}
+		s := &Schema{Type: TypeObject, Nullable: nullable, Fields: map[string]*Schema{}}
+		seen[t] = s
+		for name, field := range structInfoOf(t).fields {
+			s.Fields[name] = schemaOfType(field.typ, seen)
+		}
+		return s
+	}
+	return anySchema
+}
@@ -0,0 +1,196 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+type testAudit struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Country   int       `json:"country"`
+}
+
+type testInput struct {
+	testAudit
+	Country    string             `json:"country"`
+	Population int                `json:"population"`
+	Capital    *bool              `json:"capital,omitempty"`
+	Address    testAddress        `json:"address"`
+	Districts  []testAddress      `json:"districts"`
+	Tags       map[string]string  `json:"tags"`
+	Code       int                `json:"code,string"`
+	Ignored    string             `json:"-"`
+	Parent     *testInput         `json:"parent"`
+	Extra      map[string]float64 `json:"-"`
+	internal   string
+}
+
+const testJSONSchema = `{
+	"type": "object",
+	"properties": {
+		"country": {"type": "string", "enum": ["Turkey", "England", "Germany"]},
+		"population": {"type": "integer"},
+		"capital": {"type": ["boolean", "null"]},
+		"createdAt": {"type": "string", "format": "date-time"},
+		"address": {"$ref": "#/$defs/address"},
+		"districts": {"type": "array", "items": {"$ref": "#/$defs/address"}},
+		"tags": {"type": "object"},
+		"code": {"type": "string"},
+		"parent": {"$ref": "#"}
+	},
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}, "country": {"type": "string"}}
+		}
+	}
+}`
+
+func TestSchemaOf(t *testing.T) {
+	schema, err := SchemaOf(&testInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]*Schema{
+		"country":    {Type: TypeString},
+		"population": {Type: TypeNumber},
+		"capital":    {Type: TypeBool, Nullable: true},
+		"createdAt":  {Type: TypeTime},
+		"tags":       {Type: TypeObject, Nullable: true, Items: &Schema{Type: TypeString}},
+		// the string option of a json tag does not change the type rules see
+		"code": {Type: TypeNumber},
+	}
+	for name, field := range expected {
+		if !reflect.DeepEqual(schema.Fields[name], field) {
+			t.Errorf("Fields[%q] = %+v; expected %+v", name, schema.Fields[name], field)
+		}
+	}
+	for _, name := range []string{"Ignored", "Extra", "internal", "testAudit"} {
+		if _, exists := schema.Fields[name]; exists {
+			t.Errorf("Fields[%q] exists; expected it to be skipped", name)
+		}
+	}
+	if schema.Fields["parent"].Fields["parent"] != schema.Fields["parent"] {
+		t.Errorf("expected a recursive type to have a recursive schema")
+	}
+
+	if _, err := SchemaOf(42); err == nil {
+		t.Errorf("expected an error for a schema that is not an object")
+	}
+}
+
+func TestWithSchema(t *testing.T) {
+	structSchema, err := SchemaOf(testInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jsonSchema, err := SchemaFromJSONSchema([]byte(testJSONSchema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rule := func(field, operator, value string) string {
+		return `{"conditions":[{"all":[{"field":"` + field + `","operator":"` + operator + `","value":` + value + `}]}]}`
+	}
+	tests := []struct {
+		rules   string
+		err     error
+		message string
+	}{
+		{rule("country", "in", `["Turkey","England"]`), nil, ""},
+		{rule("population", "greaterThan", `19000`), nil, ""},
+		{rule("population", "greaterThan", `"19000"`), nil, ""},
+		{rule("address.city", "startsWith", `"Ist"`), nil, ""},
+		{rule("districts[*].city", "equals", `"Kadikoy"`), nil, ""},
+		{rule("districts[0].country", "equals", `"Turkey"`), nil, ""},
+		{rule("tags.climate", "equals", `"mild"`), nil, ""},
+		{rule("capital", "equals", `null`), nil, ""},
+		{rule("createdAt", "withinLast", `"30d"`), nil, ""},
+		{rule("parent.parent.population", "lessThan", `1`), nil, ""},
+		{rule("external.score", "greaterThan", `1`), ErrCustomOperationNotFound, ""},
+		{rule("populaton", "greaterThan", `19000`), ErrUnknownField, `did you mean "population"?`},
+		{rule("address.zip", "equals", `"34000"`), ErrUnknownField, ""},
+		{rule("country.name", "equals", `"Turkey"`), ErrUnknownField, `"country" is not an object`},
+		{rule("population[0]", "equals", `1`), ErrUnknownField, "not an array"},
+		{rule("country", "equals", `90`), ErrTypeMismatch, `operator "equals" expects a string value for field "country"`},
+		{rule("country", "in", `["Turkey",90]`), ErrTypeMismatch, `operator "in" expects a string value for field "country"`},
+		{rule("country", "equals", `null`), ErrTypeMismatch, "got null"},
+		{rule("population", "startsWith", `"1"`), ErrTypeMismatch, `operator "startsWith" expects a string field for field "population"`},
+		{rule("capital", "equals", `"yes"`), ErrTypeMismatch, "boolean or null"},
+		{rule("address", "greaterThan", `1`), ErrTypeMismatch, "got object"},
+	}
+
+	for _, schema := range []*Schema{structSchema, jsonSchema} {
+		for _, test := range tests {
+			_, err := Compile(test.rules, WithSchema(schema))
+			if !errors.Is(err, test.err) || (err != nil && !strings.Contains(err.Error(), test.message)) {
+				t.Errorf("Compile(%s) error = %v; expected %v %q", test.rules, err, test.err, test.message)
+			}
+		}
+	}
+
+	// enums come from JSON Schema documents
+	if _, err := Compile(rule("country", "equals", `"France"`), WithSchema(jsonSchema)); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("error = %v; expected a value missing from the enum to be rejected", err)
+	}
+	// a field with the string option of a json tag is compared as the value it holds
+	program, err := Compile(rule("code", "equals", `5`), WithSchema(structSchema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result, err := program.Eval(testInput{Code: 5}); err != nil || !result {
+		t.Errorf("Eval = %v, %v; expected true", result, err)
+	}
+	if _, err := Compile(rule("code", "startsWith", `"5"`), WithSchema(structSchema)); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("error = %v; expected %v", err, ErrTypeMismatch)
+	}
+	// Validate reports the rules the schema rejects
+	ruleSet := RuleSet{Conditions: []ConditionSet{{All: []Rule{{Field: "populaton", Operator: "greaterThan", Value: 1}}}}}
+	if diagnostics := Validate(ruleSet, WithSchema(structSchema)); !diagnostics.HasErrors() {
+		t.Errorf("Validate() = %v; expected the unknown field to be reported", diagnostics)
+	}
+}
+
+func TestTypeObjectAccepts(t *testing.T) {
+	var missing *testAddress
+	tests := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"city": "Istanbul"}, true},
+		{testAddress{City: "Istanbul"}, true},
+		{&testAddress{City: "Istanbul"}, true},
+		{missing, false},
+		{nil, false},
+		{time.Now(), false},
+		{"Istanbul", false},
+	}
+	for _, test := range tests {
+		if accepted := TypeObject.Accepts(test.value); accepted != test.expected {
+			t.Errorf("TypeObject.Accepts(%#v) = %v; expected %v", test.value, accepted, test.expected)
+		}
+	}
+}
+
+func TestSchemaFromJSONSchemaErrors(t *testing.T) {
+	documents := []string{
+		`{"type": "object"`,
+		`{"type": "string"}`,
+		`{"type": "object", "properties": {"a": {"type": "text"}}}`,
+		`{"type": "object", "properties": {"a": {"$ref": "other.json#/a"}}}`,
+	}
+	for _, document := range documents {
+		if _, err := SchemaFromJSONSchema([]byte(document)); err == nil {
+			t.Errorf("SchemaFromJSONSchema(%s) expected an error", document)
+		}
+	}
+}
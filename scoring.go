@@ -0,0 +1,46 @@
+package rule
+
+// Scoring makes a rule set pass by the weights of its passing rules instead of its conditions:
+// every condition set and rule is evaluated, the weights of the rules, groups and condition
+// sets that pass are summed and the rule set passes when the sum reaches the threshold. Under
+// a none or a not, a rule or group adds its weight when it fails, as then the negation passes.
+type Scoring struct {
+	Threshold float64 `json:"threshold"`
+}
+
+// Contribution is the weight a rule, group or condition set added to the score of a rule set
+// in scoring mode
+type Contribution struct {
+	// Path is the location of the rule in the RuleSet, e.g. "conditions[0].all[1]"
+	Path   string  `json:"path"`
+	ID     string  `json:"id,omitempty"`
+	Weight float64 `json:"weight"`
+}
+
+// scoreSheet is the score of an evaluation in scoring mode
+type scoreSheet struct {
+	total         float64
+	contributions []Contribution
+	// negated is set while the rules of a none or a not are evaluated
+	negated bool
+}
+
+// addScore adds the weight of a rule, group or condition set to the score when its outcome
+// counts toward a pass: when it passed, or when it failed under a none or a not
+func (e *evaluation) addScore(passed bool, weight float64, path, id string) {
+	if e.score == nil || weight == 0 || passed == e.score.negated {
+		return
+	}
+	e.score.total += weight
+	e.score.contributions = append(e.score.contributions, Contribution{Path: path, ID: id, Weight: weight})
+}
+
+// negate evaluates the rules of a none or a not, whose outcomes count toward a pass the other
+// way round. A scored evaluation is sequential, so the flag is not shared with other rules.
+func (e *evaluation) negate(eval func() (bool, error)) (bool, error) {
+	if e.score != nil {
+		e.score.negated = !e.score.negated
+		defer func() { e.score.negated = !e.score.negated }()
+	}
+	return eval()
+}
@@ -0,0 +1,159 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fraudRules = `{
+	"scoring": {"threshold": 50},
+	"conditions": [
+		{"any": [
+			{"field": "amount", "operator": "greaterThan", "value": 1000, "weight": 30, "id": "large-amount"},
+			{"field": "country", "operator": "notIn", "value": ["TR"], "weight": 20},
+			{"all": [
+				{"field": "newAccount", "operator": "equals", "value": true},
+				{"field": "night", "operator": "equals", "value": true}
+			], "weight": 40}
+		]},
+		{"all": [{"field": "amount", "operator": "lessThan", "value": 100}], "weight": 5}
+	],
+	"event": {"type": "review"},
+	"onFailure": {"type": "approve"}
+}`
+
+func TestScoring(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithParallelism(4)}} {
+		program, err := Compile(fraudRules, opts...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		result, err := program.Run(`{"amount": 5000, "country": "DE", "newAccount": false, "night": true}`)
+		expected := []Contribution{{Path: "conditions[0].any[0]", ID: "large-amount", Weight: 30}, {Path: "conditions[0].any[1]", Weight: 20}}
+		if err != nil || !result.Passed || result.Score != 50 || !reflect.DeepEqual(result.Contributions, expected) {
+			t.Errorf("Run() = %+v, %v; expected a score of 50 from the first two rules", result, err)
+		}
+		if len(result.Actions) != 1 || result.Actions[0].Type != "review" {
+			t.Errorf("actions = %+v; expected the event", result.Actions)
+		}
+
+		// the first condition set passes without scoring enough, the failing second one is still scored
+		result, err = program.Run(`{"amount": 10, "country": "TR", "newAccount": true, "night": true}`)
+		expected = []Contribution{{Path: "conditions[0].any[2]", Weight: 40}, {Path: "conditions[1]", Weight: 5}}
+		if err != nil || result.Passed || result.Score != 45 || !reflect.DeepEqual(result.Contributions, expected) {
+			t.Errorf("Run() = %+v, %v; expected a score of 45", result, err)
+		}
+		if len(result.Actions) != 1 || result.Actions[0].Type != "approve" {
+			t.Errorf("actions = %+v; expected the onFailure actions", result.Actions)
+		}
+
+		// a missing field does not match and adds nothing, the rest of the input is scored
+		result, err = program.Run(`{"amount": 10, "country": "TR"}`)
+		expected = []Contribution{{Path: "conditions[1]", Weight: 5}}
+		if err != nil || result.Passed || result.Score != 5 || !reflect.DeepEqual(result.Contributions, expected) {
+			t.Errorf("Run() = %+v, %v; expected a score of 5 from a partial input", result, err)
+		}
+	}
+}
+
+func TestScoringNegations(t *testing.T) {
+	program, err := Compile(`{
+		"scoring": {"threshold": 5},
+		"conditions": [
+			{"none": [{"field": "blocked", "operator": "equals", "value": true, "weight": 10}]},
+			{"not": {"all": [
+				{"field": "country", "operator": "equals", "value": "XX", "weight": 4},
+				{"not": {"field": "amount", "operator": "greaterThan", "value": 100, "weight": 3}}
+			], "weight": 7}}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// every condition fails, the rules that match under none and not make them fail
+	result, err := program.Run(`{"blocked": true, "country": "XX", "amount": 10}`)
+	if err != nil || result.Passed || result.Score != 0 || len(result.Contributions) != 0 {
+		t.Errorf("Run() = %+v, %v; expected no score from the matches that fail the negations", result, err)
+	}
+
+	// a rule or group failing under a none or a not adds its weight, as the negation passes
+	result, err = program.Run(`{"blocked": false, "country": "XX", "amount": 500}`)
+	expected := []Contribution{{Path: "conditions[0].none[0]", Weight: 10}, {Path: "conditions[1].not.all[1].not", Weight: 3}, {Path: "conditions[1].not", Weight: 7}}
+	if err != nil || !result.Passed || result.Score != 20 || !reflect.DeepEqual(result.Contributions, expected) {
+		t.Errorf("Run() = %+v, %v; expected a score of 20 from the passing negations", result, err)
+	}
+
+	// a missing field adds nothing under a none or a not either
+	result, err = program.Run(`{"country": "YY"}`)
+	expected = []Contribution{{Path: "conditions[1].not.all[0]", Weight: 4}, {Path: "conditions[1].not", Weight: 7}}
+	if err != nil || !result.Passed || result.Score != 11 || !reflect.DeepEqual(result.Contributions, expected) {
+		t.Errorf("Run() = %+v, %v; expected a score of 11 from a partial input", result, err)
+	}
+}
+
+func TestScoringTrace(t *testing.T) {
+	program, err := Compile(fraudRules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trace, err := program.Explain(`{"amount": 5000, "country": "DE", "newAccount": false, "night": true}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !trace.Result || trace.Score == nil || *trace.Score != 50 {
+		t.Errorf("trace = %+v; expected the score of the rule set", trace)
+	}
+	// every rule is evaluated in scoring mode, none is skipped
+	text := trace.String()
+	if strings.Contains(text, "SKIP") || !strings.Contains(text, "PASS  rule set (score 50)") || !strings.Contains(text, "(weight 30)") {
+		t.Errorf("trace = %s; expected every rule with its weight", text)
+	}
+	if second := trace.Children[1]; second.Result || second.Weight != 5 {
+		t.Errorf("trace = %+v; expected the failed weighted condition set", second)
+	}
+}
+
+func TestScoringEngine(t *testing.T) {
+	engine := NewEngine(HighestScore)
+	engine.Add("fraud", 10, fraudRules)
+	engine.Add("vip", 0, `{"scoring": {"threshold": 10}, "conditions": [{"any": [
+		{"field": "amount", "operator": "greaterThan", "value": 1000, "weight": 60},
+		{"field": "country", "operator": "equals", "value": "DE", "weight": 10}
+	]}]}`)
+	engine.Add("static", 5, `{"score": 55, "conditions": []}`)
+
+	matches, err := engine.Run(`{"amount": 5000, "country": "DE", "newAccount": false, "night": true}`)
+	if err != nil || len(matches) != 1 || matches[0].ID != "vip" || matches[0].Score != 70 {
+		t.Errorf("matches = %+v, %v; expected the highest computed score", matches, err)
+	}
+	matches, err = engine.Run(`{"amount": 500, "country": "DE", "newAccount": true, "night": true}`)
+	if err != nil || len(matches) != 1 || matches[0].ID != "fraud" || matches[0].Score != 60 {
+		t.Errorf("matches = %+v, %v; expected the fraud rule set", matches, err)
+	}
+}
+
+func TestValidateScoring(t *testing.T) {
+	diagnostics := Validate(RuleSet{Scoring: &Scoring{Threshold: 1}, Conditions: []ConditionSet{{All: []Rule{{Field: "a", Operator: "equals", Value: 1.0}}}}})
+	if len(diagnostics) != 1 || diagnostics[0].Path != "scoring" || diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("diagnostics = %v; expected a warning for a score without weights", diagnostics)
+	}
+	diagnostics = Validate(RuleSet{Conditions: []ConditionSet{{All: []Rule{{Field: "a", Operator: "equals", Value: 1.0, Weight: 5}}}}})
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "scoring mode") {
+		t.Errorf("diagnostics = %v; expected a warning for weights without scoring", diagnostics)
+	}
+
+	ruleSet, err := ParseRuleSet([]byte(fraudRules), FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diagnostics := Validate(ruleSet); len(diagnostics) != 0 {
+		t.Errorf("diagnostics = %v", diagnostics)
+	}
+	if _, err := MarshalRuleSet(ruleSet, FormatExpression); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for scoring in an expression; got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package rule
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldAccessor is implemented by inputs that look up their own fields, rules are then
+// evaluated against them without reflection. cmd/rulegen generates it for structs.
+// RuleField returns the value of the field with the name rules use, and false when the
+// input has no such field.
+type FieldAccessor interface {
+	RuleField(name string) (interface{}, bool)
+}
+
+// structField is a field of a struct under the name rules use
+type structField struct {
+	index []int
+	typ   reflect.Type
+}
+
+// structInfo is the reflection metadata of a struct type
+type structInfo struct {
+	fields map[string]*structField
+	// names are the field names in order, for wildcards
+	names []string
+}
+
+// structInfos caches the structInfo of every struct type inputs have used
+var structInfos sync.Map
+
+// structInfoOf returns the fields of a struct type. Fields are named by their rule tag, by
+// their json tag when they have none, and by their Go name otherwise. A tag of "-" skips
+// the field. The fields of embedded structs without a name are fields of the struct
+// unless it has its own field of the name.
+func structInfoOf(t reflect.Type) *structInfo {
+	if info, exists := structInfos.Load(t); exists {
+		return info.(*structInfo)
+	}
+	info := &structInfo{fields: map[string]*structField{}}
+	addFields(t, nil, info.fields, map[reflect.Type]bool{})
+	for name := range info.fields {
+		info.names = append(info.names, name)
+	}
+	sort.Strings(info.names)
+	actual, _ := structInfos.LoadOrStore(t, info)
+	return actual.(*structInfo)
+}
+
+// addFields adds the fields of a struct under index, visiting holds the embedded structs
+// being added so embedding cycles end
+func addFields(t reflect.Type, index []int, fields map[string]*structField, visiting map[reflect.Type]bool) {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	type embeddedStruct struct {
+		typ   reflect.Type
+		index []int
+	}
+	var embedded []embeddedStruct
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := fieldName(field)
+		if skip {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], i)
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				if !visiting[fieldType] {
+					embedded = append(embedded, embeddedStruct{fieldType, fieldIndex})
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = &structField{index: fieldIndex, typ: field.Type}
+	}
+
+	for _, e := range embedded {
+		inner := map[string]*structField{}
+		addFields(e.typ, e.index, inner, visiting)
+		for name, field := range inner {
+			if _, exists := fields[name]; !exists {
+				fields[name] = field
+			}
+		}
+	}
+}
+
+// fieldName reads the name of a field from its tags, an empty name keeps the Go name. The
+// string option of a json tag is ignored, rules see the value of the field.
+func fieldName(field reflect.StructField) (name string, skip bool) {
+	if tag, exists := field.Tag.Lookup("rule"); exists {
+		name, _, _ = strings.Cut(tag, ",")
+		return name, name == "-"
+	}
+	name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" && options == "" {
+		return "", true
+	}
+	return name, false
+}
+
+// selectStruct applies a path segment to a struct
+func selectStruct(value reflect.Value, segment pathSegment) []interface{} {
+	info := structInfoOf(value.Type())
+	switch segment.kind {
+	case segmentKey:
+		if child, exists := info.field(value, segment.key); exists {
+			return []interface{}{child}
+		}
+	case segmentWildcard:
+		children := make([]interface{}, 0, len(info.names))
+		for _, name := range info.names {
+			if child, exists := info.field(value, name); exists {
+				children = append(children, child)
+			}
+		}
+		return children
+	}
+	return nil
+}
+
+// field reads a field of a struct value, the fields of a nil embedded struct do not exist
+func (info *structInfo) field(value reflect.Value, name string) (interface{}, bool) {
+	field, exists := info.fields[name]
+	if !exists {
+		return nil, false
+	}
+	child, err := value.FieldByIndexErr(field.index)
+	if err != nil {
+		return nil, false
+	}
+	return reflectValue(child), true
+}
+
+// inputValue converts a value read from a struct, a FieldAccessor or a map of another type
+// to a value the operators handle
+func inputValue(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, string, bool, int, int64, float64, json.Number, time.Time, map[string]interface{}, []interface{}:
+		return value
+	}
+	return reflectValue(reflect.ValueOf(value))
+}
+
+// reflectValue dereferences pointers, nil pointers are null, and converts named strings,
+// booleans and numbers to their underlying type so e.g. a `type Country string` field
+// compares to a string
+func reflectValue(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+	t := value.Type()
+	if t.PkgPath() == "" || t == jsonNumberType {
+		return value.Interface()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	return value.Interface()
+}
@@ -0,0 +1,162 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testCountry string
+
+type testCity struct {
+	Name    string `json:"name"`
+	Capital *bool  `json:"capital,omitempty"`
+}
+
+type testOrigin struct {
+	Continent string `json:"continent"`
+}
+
+type testCountryInput struct {
+	*testOrigin
+	Name       testCountry        `json:"country" rule:"name"`
+	Population int                `json:"population"`
+	Founded    time.Time          `json:"founded"`
+	Capital    *testCity          `json:"capital"`
+	Cities     []testCity         `json:"cities"`
+	Languages  map[string]float64 `json:"languages"`
+	Secret     string             `rule:"-"`
+	Code       string
+}
+
+// testAccessorInput implements FieldAccessor like the code cmd/rulegen generates
+type testAccessorInput struct {
+	Name  string    `json:"country"`
+	City  testCity  `json:"city"`
+	calls *[]string `json:"-"`
+}
+
+func (x testAccessorInput) RuleField(name string) (interface{}, bool) {
+	*x.calls = append(*x.calls, name)
+	switch name {
+	case "city":
+		return x.City, true
+	case "country":
+		return x.Name, true
+	}
+	return nil, false
+}
+
+func TestEvaluateStruct(t *testing.T) {
+	capital := true
+	input := &testCountryInput{
+		testOrigin: &testOrigin{Continent: "Europe"},
+		Name:       "Turkey",
+		Population: 85000000,
+		Founded:    time.Date(1923, 10, 29, 0, 0, 0, 0, time.UTC),
+		Capital:    &testCity{Name: "Ankara", Capital: &capital},
+		Cities:     []testCity{{Name: "Istanbul"}, {Name: "Izmir"}},
+		Languages:  map[string]float64{"Turkish": 0.9, "Kurdish": 0.1},
+		Secret:     "hidden",
+		Code:       "TR",
+	}
+
+	testCases := []struct {
+		name     string
+		rule     Rule
+		expected bool
+	}{
+		{"rule tag over json tag", Rule{Field: "name", Operator: "equals", Value: "Turkey"}, true},
+		{"json tag skipped for a rule tag", Rule{Field: "country", Operator: "equals", Value: "Turkey"}, false},
+		{"number", Rule{Field: "population", Operator: "greaterThan", Value: 1000000}, true},
+		{"time", Rule{Field: "founded", Operator: "before", Value: "1950-01-01"}, true},
+		{"pointer to a nested struct", Rule{Field: "capital.name", Operator: "equals", Value: "Ankara"}, true},
+		{"pointer to a bool", Rule{Field: "capital.capital", Operator: "equals", Value: true}, true},
+		{"slice index", Rule{Field: "cities[1].name", Operator: "equals", Value: "Izmir"}, true},
+		{"slice wildcard", Rule{Field: "cities[*].name", Operator: "equals", Value: "Istanbul"}, true},
+		{"missing pointer in a slice", Rule{Field: "cities[*].capital", Operator: "equals", Value: true}, false},
+		{"map", Rule{Field: "languages.Turkish", Operator: "greaterThan", Value: 0.5}, true},
+		{"embedded struct", Rule{Field: "continent", Operator: "equals", Value: "Europe"}, true},
+		{"go name", Rule{Field: "Code", Operator: "equals", Value: "TR"}, true},
+		{"skipped field", Rule{Field: "Secret", Operator: "equals", Value: "hidden"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := CompileRuleSet(RuleSet{Conditions: []ConditionSet{{All: []Rule{tc.rule}}}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, in := range []interface{}{input, *input} {
+				result, err := program.Eval(in)
+				if tc.expected && err != nil {
+					t.Fatalf("unexpected error for %T: %v", in, err)
+				}
+				if result != tc.expected {
+					t.Errorf("Eval(%T) = %v; expected %v", in, result, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateStructNilPointers(t *testing.T) {
+	program, err := CompileRuleSet(RuleSet{Conditions: []ConditionSet{{All: []Rule{
+		{Field: "capital", Operator: "equals", Value: nil},
+	}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result, err := program.Eval(&testCountryInput{}); err != nil || !result {
+		t.Errorf("Eval() = %v, %v; expected a nil pointer to be null", result, err)
+	}
+
+	// the fields of a nil embedded struct do not exist
+	_, err = Evaluate(&testCountryInput{}, `{"conditions": [{"all": [{"field": "continent", "operator": "equals", "value": "Europe"}]}]}`, nil)
+	if !errors.Is(err, ErrMissingField) {
+		t.Errorf("expected ErrMissingField; got %v", err)
+	}
+
+	var nilInput *testCountryInput
+	if _, err := program.Eval(nilInput); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput for a nil pointer; got %v", err)
+	}
+	if _, err := program.Eval(42); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput for a number; got %v", err)
+	}
+}
+
+func TestEvaluateFieldAccessor(t *testing.T) {
+	var calls []string
+	input := testAccessorInput{Name: "Turkey", City: testCity{Name: "Ankara"}, calls: &calls}
+
+	rules := `{"conditions": [{"all": [
+		{"field": "country", "operator": "equals", "value": "Turkey"},
+		{"field": "city.name", "operator": "equals", "value": "Ankara"}
+	]}]}`
+	result, err := Evaluate(input, rules, nil)
+	if err != nil || !result {
+		t.Fatalf("Evaluate() = %v, %v; expected true", result, err)
+	}
+	if len(calls) != 3 || calls[0] != "country" {
+		t.Errorf("RuleField calls = %v; expected the fields to be read through the accessor", calls)
+	}
+}
+
+func TestStructInfoOf(t *testing.T) {
+	info := structInfoOf(reflect.TypeOf(testCountryInput{}))
+	if info != structInfoOf(reflect.TypeOf(testCountryInput{})) {
+		t.Errorf("expected the struct info to be cached")
+	}
+
+	expected := []string{"Code", "capital", "cities", "continent", "founded", "languages", "name", "population"}
+	if len(info.names) != len(expected) {
+		t.Fatalf("names = %v; expected %v", info.names, expected)
+	}
+	for i, name := range expected {
+		if info.names[i] != name {
+			t.Errorf("names[%d] = %q; expected %q", i, info.names[i], name)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestFile is a rule document and the test cases of its rules, written in JSON, YAML or TOML
+type TestFile struct {
+	// Rules is the path of the rule document, relative to the test file
+	Rules string `json:"rules,omitempty"`
+	// RuleSet holds the rules when they are written in the test file instead
+	RuleSet *RuleSet   `json:"ruleSet,omitempty"`
+	Tests   []TestCase `json:"tests"`
+}
+
+// TestCase is an input and the outcome the rules are expected to have for it
+type TestCase struct {
+	Name  string                 `json:"name"`
+	Input map[string]interface{} `json:"input"`
+	// Passed is whether the rules are expected to pass
+	Passed bool `json:"passed"`
+	// Actions are the actions expected to be fired, they are not checked when nil
+	Actions *Actions `json:"actions,omitempty"`
+	// Trace maps the paths of condition sets, groups and rules to their expected outcome:
+	// pass, fail, skip or error
+	Trace map[string]string `json:"trace,omitempty"`
+	// Error is a part of the message of the error the evaluation is expected to fail with
+	Error string `json:"error,omitempty"`
+}
+
+// TestSuite is the outcome of the test cases of a test file
+type TestSuite struct {
+	// Name is the path of the test file
+	Name  string
+	Cases []TestCaseResult
+	Time  time.Duration
+}
+
+// TestCaseResult is the outcome of a test case
+type TestCaseResult struct {
+	Name string
+	// Failure tells how the outcome differs from the expected one, with a diff of the trace,
+	// it is empty when the test case passed
+	Failure string
+	Time    time.Duration
+}
+
+// Failures returns the number of failed test cases
+func (s *TestSuite) Failures() int {
+	failures := 0
+	for _, c := range s.Cases {
+		if c.Failure != "" {
+			failures++
+		}
+	}
+	return failures
+}
+
+// LoadTestFile reads a test file, its format is taken from its extension
+func LoadTestFile(path string) (*TestFile, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatExpression {
+		return nil, fmt.Errorf("%w: test file %q is not JSON, YAML or TOML", ErrInvalidRules, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if data, err = json.Marshal(doc.value); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// a misspelled expectation must not be ignored
+	decoder.DisallowUnknownFields()
+	var file TestFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", path, ErrInvalidRules, err)
+	}
+	if (file.Rules == "") == (file.RuleSet == nil) {
+		return nil, fmt.Errorf("%s: %w: a test file needs either rules or a ruleSet", path, ErrInvalidRules)
+	}
+	return &file, nil
+}
+
+// RunTestFile loads a test file, compiles its rules with the options and runs its test cases
+func RunTestFile(path string, opts ...Option) (*TestSuite, error) {
+	file, err := LoadTestFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var program *Program
+	if file.RuleSet != nil {
+		program, err = CompileRuleSet(*file.RuleSet, opts...)
+	} else {
+		program, err = compileFile(filepath.Join(filepath.Dir(path), file.Rules), opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Run(path, program), nil
+}
+
+// compileFile reads and compiles a rule document
+func compileFile(path string, opts ...Option) (*Program, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := CompileDocument(data, format, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return program, nil
+}
+
+// Run runs the test cases against the program, the suite is named by name
+func (f *TestFile) Run(name string, program *Program) *TestSuite {
+	suite := &TestSuite{Name: name}
+	start := time.Now()
+	for i, tc := range f.Tests {
+		caseStart := time.Now()
+		result := TestCaseResult{Name: tc.Name, Failure: tc.run(program)}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("tests[%d]", i)
+		}
+		result.Time = time.Since(caseStart)
+		suite.Cases = append(suite.Cases, result)
+	}
+	suite.Time = time.Since(start)
+	return suite
+}
+
+// run evaluates the input of the test case and returns its failure
+func (tc TestCase) run(program *Program) string {
+	// the actions are those of a run, a rule set outside its effective window fires none
+	result, trace, err := program.RunExplain(tc.Input)
+	if trace == nil {
+		return fmt.Sprintf("unexpected error: %v", err)
+	}
+
+	var failures []string
+	mismatched := map[*Trace]string{}
+	switch {
+	case tc.Error != "" && err == nil:
+		failures = append(failures, fmt.Sprintf("expected an error containing %q, got none", tc.Error))
+	case tc.Error != "" && !strings.Contains(err.Error(), tc.Error):
+		failures = append(failures, fmt.Sprintf("expected an error containing %q, got %v", tc.Error, err))
+	case tc.Error == "" && err != nil:
+		failures = append(failures, fmt.Sprintf("unexpected error: %v", err))
+	case tc.Error == "" && trace.Result != tc.Passed:
+		failures = append(failures, fmt.Sprintf("expected the rules to %s, they did not", passOrFail(tc.Passed)))
+		mismatched[trace] = passOrFail(tc.Passed)
+	}
+
+	if tc.Actions != nil && err == nil {
+		actions := result.Actions
+		if !sameJSON(actions, []Action(*tc.Actions)) {
+			failures = append(failures, fmt.Sprintf("expected the actions %s, got %s", formatValue(*tc.Actions), formatValue(actions)))
+		}
+	}
+
+	paths := make([]string, 0, len(tc.Trace))
+	for path := range tc.Trace {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		expected := tc.Trace[path]
+		node := trace.find(path)
+		switch {
+		case node == nil:
+			failures = append(failures, fmt.Sprintf("the trace has no %s", path))
+		case node.status() != expected:
+			failures = append(failures, fmt.Sprintf("expected %s to %s, got %s", path, expected, node.status()))
+			mismatched[node] = expected
+		}
+	}
+
+	if len(failures) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(strings.Join(failures, "\n"))
+	b.WriteString("\n\ntrace:\n")
+	trace.writeDiff(&b, 0, mismatched)
+	return b.String()
+}
+
+func passOrFail(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "fail"
+}
+
+// sameJSON reports whether two lists of actions are encoded as the same JSON, so numbers
+// of any type compare by value
+func sameJSON(a, b []Action) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	// encoding/json sorts the keys of maps and writes 10.0 as 10
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && bytes.Equal(x, y)
+}
+
+// find returns the first node of the path
+func (t *Trace) find(path string) *Trace {
+	if t.Path == path && t.Kind != TraceRuleSet {
+		return t
+	}
+	for _, child := range t.Children {
+		if found := child.find(path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// writeDiff renders the trace like String does, a node whose outcome is not the expected
+// one is rendered twice, the expected outcome prefixed with "-" and the actual with "+"
+func (t *Trace) writeDiff(b *strings.Builder, depth int, expected map[*Trace]string) {
+	indent := strings.Repeat("  ", depth)
+	if status, exists := expected[t]; exists {
+		fmt.Fprintf(b, "- %s%-6s%s\n", indent, strings.ToUpper(status), t.describe())
+		fmt.Fprintf(b, "+ %s%-6s%s\n", indent, strings.ToUpper(t.status()), t.describe())
+	} else {
+		fmt.Fprintf(b, "  %s%-6s%s\n", indent, strings.ToUpper(t.status()), t.describe())
+	}
+	for _, child := range t.Children {
+		child.writeDiff(b, depth+1, expected)
+	}
+}
+
+// WriteJUnit writes the suites as a JUnit XML report, the format CI servers read test results in
+func WriteJUnit(w io.Writer, suites ...*TestSuite) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testCase struct {
+		Name      string   `xml:"name,attr"`
+		ClassName string   `xml:"classname,attr"`
+		Time      string   `xml:"time,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+	}
+	type testSuite struct {
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Time     string     `xml:"time,attr"`
+		Cases    []testCase `xml:"testcase"`
+	}
+	type testSuites struct {
+		XMLName  xml.Name    `xml:"testsuites"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Suites   []testSuite `xml:"testsuite"`
+	}
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", d.Seconds())
+	}
+
+	report := testSuites{}
+	for _, suite := range suites {
+		s := testSuite{Name: suite.Name, Tests: len(suite.Cases), Failures: suite.Failures(), Time: seconds(suite.Time)}
+		for _, c := range suite.Cases {
+			tc := testCase{Name: c.Name, ClassName: suite.Name, Time: seconds(c.Time)}
+			if c.Failure != "" {
+				message, _, _ := strings.Cut(c.Failure, "\n")
+				tc.Failure = &failure{Message: message, Text: c.Failure}
+			}
+			s.Cases = append(s.Cases, tc)
+		}
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Suites = append(report.Suites, s)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,199 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSuiteRules = `conditions:
+  - all:
+      - field: country
+        operator: equals
+        value: Turkey
+      - field: population
+        operator: greaterThan
+        value: 1000
+actions:
+  - type: discount
+    params:
+      percent: 10
+`
+
+const testSuiteCases = `rules: rules.yaml
+tests:
+  - name: big turkish city
+    input: {country: Turkey, population: 5000}
+    passed: true
+    actions:
+      - type: discount
+        params: {percent: 10}
+  - name: small turkish city
+    input: {country: Turkey, population: 500}
+    passed: false
+    trace:
+      conditions[0].all[0]: pass
+      conditions[0].all[1]: fail
+  - name: missing population
+    input: {country: Turkey}
+    error: missing field
+`
+
+// writeTestFiles writes files into a temporary directory and returns its path
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunTestFile(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"rules.yaml": testSuiteRules, "rules.test.yaml": testSuiteCases})
+
+	suite, err := RunTestFile(filepath.Join(dir, "rules.test.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(suite.Cases) != 3 || suite.Failures() != 0 {
+		t.Fatalf("cases = %+v; expected 3 passing cases", suite.Cases)
+	}
+	if suite.Cases[0].Name != "big turkish city" {
+		t.Errorf("Cases[0].Name = %q; expected the name of the test case", suite.Cases[0].Name)
+	}
+}
+
+func TestRunTestFileFailures(t *testing.T) {
+	file := &TestFile{Tests: []TestCase{
+		{Name: "result", Input: map[string]interface{}{"country": "Turkey", "population": 500}, Passed: true},
+		{Name: "actions", Input: map[string]interface{}{"country": "Turkey", "population": 5000}, Passed: true, Actions: &Actions{}},
+		{Name: "trace", Input: map[string]interface{}{"country": "Turkey", "population": 500}, Trace: map[string]string{
+			"conditions[0].all[1]": "pass",
+			"conditions[9]":        "pass",
+		}},
+		{Name: "error", Input: map[string]interface{}{"country": "Turkey", "population": 5000}, Passed: true, Error: "missing field"},
+		{Input: map[string]interface{}{"country": "Turkey"}},
+	}}
+	ruleSet, err := ParseRuleSet([]byte(testSuiteRules), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := CompileRuleSet(ruleSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suite := file.Run("rules.test.yaml", program)
+	if suite.Failures() != 5 {
+		t.Fatalf("failures = %d; expected every case to fail", suite.Failures())
+	}
+
+	expected := []string{
+		"expected the rules to pass, they did not",
+		`expected the actions [], got [{"type":"discount","params":{"percent":10}}]`,
+		"expected conditions[0].all[1] to pass, got fail",
+		`expected an error containing "missing field", got none`,
+		"unexpected error:",
+	}
+	for i, message := range expected {
+		if !strings.HasPrefix(suite.Cases[i].Failure, message) {
+			t.Errorf("Cases[%d].Failure = %q; expected it to start with %q", i, suite.Cases[i].Failure, message)
+		}
+	}
+	if !strings.Contains(suite.Cases[2].Failure, "the trace has no conditions[9]") {
+		t.Errorf("expected a failure for a path missing from the trace: %s", suite.Cases[2].Failure)
+	}
+	diff := "-       PASS  population greaterThan 1000 (actual 500) [conditions[0].all[1]]\n" +
+		"+       FAIL  population greaterThan 1000 (actual 500) [conditions[0].all[1]]\n"
+	if !strings.Contains(suite.Cases[2].Failure, diff) {
+		t.Errorf("expected the failure to contain the trace diff:\n%s", suite.Cases[2].Failure)
+	}
+	if suite.Cases[4].Name != "tests[4]" {
+		t.Errorf("Cases[4].Name = %q; expected a test case without a name to be named by its index", suite.Cases[4].Name)
+	}
+}
+
+func TestRunTestFileOutsideEffectiveWindow(t *testing.T) {
+	rules := testSuiteRules + "effectiveUntil: 2000-01-01T00:00:00Z\nonFailure:\n  - type: review\n"
+	ruleSet, err := ParseRuleSet([]byte(rules), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := CompileRuleSet(ruleSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a rule set outside its effective window fires no actions, not even its onFailure ones
+	file := &TestFile{Tests: []TestCase{
+		{Name: "expired", Input: map[string]interface{}{"country": "Turkey", "population": 5000}, Actions: &Actions{}},
+	}}
+	if suite := file.Run("rules.test.yaml", program); suite.Failures() != 0 {
+		t.Errorf("failure = %q; expected the actions of a run", suite.Cases[0].Failure)
+	}
+}
+
+func TestLoadTestFileErrors(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"misspelled.test.yaml": "rules: rules.yaml\ntests:\n  - name: x\n    pased: true\n",
+		"norules.test.json":    `{"tests": []}`,
+		"broken.test.json":     `{"rules": `,
+		"missing.test.json":    `{"rules": "missing.json", "tests": []}`,
+	})
+
+	for _, name := range []string{"misspelled.test.yaml", "norules.test.json", "broken.test.json"} {
+		if _, err := LoadTestFile(filepath.Join(dir, name)); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("LoadTestFile(%s) = %v; expected ErrInvalidRules", name, err)
+		}
+	}
+	if _, err := RunTestFile(filepath.Join(dir, "missing.test.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RunTestFile() = %v; expected the rules to be missing", err)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	suite := &TestSuite{Name: "rules.test.yaml", Cases: []TestCaseResult{
+		{Name: "passes"},
+		{Name: "fails", Failure: "expected the rules to pass, they did not\n\ntrace:\n  FAIL  rule set\n"},
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, suite); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var report struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if report.Tests != 2 || report.Failures != 1 || len(report.Suites) != 1 || report.Suites[0].Name != "rules.test.yaml" {
+		t.Fatalf("report = %+v; expected a suite with 2 tests and a failure", report)
+	}
+	failure := report.Suites[0].Cases[1].Failure
+	if report.Suites[0].Cases[0].Failure != nil || failure == nil {
+		t.Fatalf("expected the second case only to fail")
+	}
+	if failure.Message != "expected the rules to pass, they did not" || !strings.Contains(failure.Text, "FAIL  rule set") {
+		t.Errorf("failure = %+v; expected the first line as message and the trace as text", failure)
+	}
+}
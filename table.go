@@ -0,0 +1,699 @@
+package rule
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// HitPolicy decides which of the rows of a DecisionTable matching an input are returned
+type HitPolicy string
+
+const (
+	// HitUnique expects at most one row to match, more is an error. It is the default.
+	HitUnique HitPolicy = "unique"
+	// HitFirst returns the first matching row, the rows after it are not evaluated
+	HitFirst HitPolicy = "first"
+	// HitPriority returns the matching row with the highest priority, ties are broken by order
+	HitPriority HitPolicy = "priority"
+	// HitCollect returns every matching row, in order
+	HitCollect HitPolicy = "collect"
+)
+
+// DecisionTable is a table of rules: every row holds a condition on each input and the values
+// of the outputs it decides
+type DecisionTable struct {
+	HitPolicy HitPolicy `json:"hitPolicy,omitempty"`
+	// Inputs are the fields the cells of the rows check
+	Inputs  []string   `json:"inputs"`
+	Outputs []string   `json:"outputs"`
+	Rows    []TableRow `json:"rows"`
+}
+
+// TableRow is a row of a DecisionTable
+type TableRow struct {
+	// Inputs are the cells of the row, one per input of the table
+	Inputs []TableCell `json:"inputs"`
+	// Outputs are the values of the row, one per output of the table, nil leaves an output out
+	Outputs []interface{} `json:"outputs"`
+	// Priority ranks the row for the priority hit policy
+	Priority int `json:"priority,omitempty"`
+}
+
+// TableCondition is a condition of a cell on its input
+type TableCondition struct {
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// TableCell is the condition of a row on an input, every condition it holds has to pass. In
+// CSV and JSON cells are written as text, a cell that is empty or "-" matches any value:
+//
+//	"gold"         equals the value, text that is not a JSON value is a string: gold
+//	>= 100         a symbol or an operator name followed by a value, e.g. in ["TR","DE"]
+//	[100..1000)    a range, brackets include the bound and parentheses exclude it
+//
+// Only the built-in operators and custom.name operators are read from text, other text is a
+// string, e.g. Route 66. A JSON cell can also be a number or a boolean compared with equals,
+// an array compared with in, or an array of TableConditions.
+type TableCell []TableCondition
+
+// TableMatch is a row of a DecisionTable matching an input
+type TableMatch struct {
+	// Row is the index of the row in the table
+	Row     int                    `json:"row"`
+	Outputs map[string]interface{} `json:"outputs"`
+}
+
+// formatCSV is the format of decision tables written as CSV
+const formatCSV Format = "csv"
+
+// cellRange matches a range cell, e.g. "[100..1000)"
+var cellRange = regexp.MustCompile(`^([\[(])\s*(.*?)\s*\.\.\s*(.*?)\s*([\])])$`)
+
+// parseTableCell parses the text of a cell
+func parseTableCell(text string) (TableCell, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || text == "-" {
+		return nil, nil
+	}
+
+	if match := cellRange.FindStringSubmatch(text); match != nil {
+		lower, upper := "greaterThanInclusive", "lessThanInclusive"
+		if match[1] == "(" {
+			lower = "greaterThan"
+		}
+		if match[4] == ")" {
+			upper = "lessThan"
+		}
+		return TableCell{{Operator: lower, Value: parseCellValue(match[2])}, {Operator: upper, Value: parseCellValue(match[3])}}, nil
+	}
+
+	for _, symbol := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if strings.HasPrefix(text, symbol) {
+			value := strings.TrimSpace(text[len(symbol):])
+			if value == "" {
+				return nil, fmt.Errorf("%w: expected a value after %q", ErrInvalidRules, symbol)
+			}
+			return TableCell{{Operator: symbolOperators[symbol], Value: parseCellValue(value)}}, nil
+		}
+	}
+	// an operator name is followed by a JSON value, any other text is a value
+	p := &exprParser{src: text}
+	if operator := p.parseOperator(); cellOperator(operator) && p.pos < len(text) && unicode.IsSpace(rune(text[p.pos])) {
+		var value interface{}
+		if json.Unmarshal([]byte(text[p.pos:]), &value) == nil {
+			return TableCell{{Operator: operator, Value: value}}, nil
+		}
+	}
+	return valueCell(parseCellValue(text)), nil
+}
+
+// cellOperator reports whether the text of a cell can name the operator
+func cellOperator(name string) bool {
+	if _, exists := builtinRegistry.Lookup(name); exists {
+		return true
+	}
+	return strings.HasPrefix(name, "custom.") && len(name) > len("custom.")
+}
+
+// parseCellValue parses a JSON value, text that is not one is a string
+func parseCellValue(text string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return text
+	}
+	return value
+}
+
+// valueCell is a cell holding a value only, an array is compared with in and anything else with equals
+func valueCell(value interface{}) TableCell {
+	if isList(value) {
+		return TableCell{{Operator: "in", Value: value}}
+	}
+	return TableCell{{Operator: "equals", Value: value}}
+}
+
+// String renders the cell as text, a cell whose conditions can not be written as text is
+// rendered as JSON conditions
+func (c TableCell) String() string {
+	if text, ok := c.text(); ok {
+		return text
+	}
+	data, _ := json.Marshal([]TableCondition(c))
+	return string(data)
+}
+
+// text renders the cell in the syntax parseTableCell parses, if it can be
+func (c TableCell) text() (string, bool) {
+	switch {
+	case len(c) == 0:
+		return "-", true
+	case len(c) == 2 && (c[0].Operator == "greaterThan" || c[0].Operator == "greaterThanInclusive") &&
+		(c[1].Operator == "lessThan" || c[1].Operator == "lessThanInclusive"):
+		lower, upper := "[", "]"
+		if c[0].Operator == "greaterThan" {
+			lower = "("
+		}
+		if c[1].Operator == "lessThan" {
+			upper = ")"
+		}
+		return lower + formatValue(c[0].Value) + ".." + formatValue(c[1].Value) + upper, true
+	case len(c) > 1:
+		return "", false
+	}
+
+	condition := c[0]
+	switch {
+	case condition.Operator == "equals" && !isList(condition.Value):
+		// strings are written without quotes when they read back the same
+		if text, ok := condition.Value.(string); ok {
+			if parsed, err := parseTableCell(text); err == nil && reflect.DeepEqual(parsed, c) {
+				return text, true
+			}
+		}
+		return formatValue(condition.Value), true
+	case condition.Operator == "in" && isList(condition.Value):
+		return formatValue(condition.Value), true
+	}
+	for symbol, name := range symbolOperators {
+		if name == condition.Operator {
+			return symbol + " " + formatValue(condition.Value), true
+		}
+	}
+	p := &exprParser{src: condition.Operator}
+	if p.parseOperator() != condition.Operator || !cellOperator(condition.Operator) {
+		return "", false
+	}
+	return condition.Operator + " " + formatValue(condition.Value), true
+}
+
+func (c TableCell) MarshalJSON() ([]byte, error) {
+	if text, ok := c.text(); ok {
+		return json.Marshal(text)
+	}
+	return json.Marshal([]TableCondition(c))
+}
+
+func (c *TableCell) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		cell, err := parseTableCell(v)
+		if err != nil {
+			return err
+		}
+		*c = cell
+		return nil
+	case map[string]interface{}:
+		var condition TableCondition
+		if err := json.Unmarshal(data, &condition); err != nil {
+			return err
+		}
+		*c = TableCell{condition}
+		return nil
+	case []interface{}:
+		if isConditions(v) {
+			var conditions []TableCondition
+			if err := json.Unmarshal(data, &conditions); err != nil {
+				return err
+			}
+			*c = conditions
+			return nil
+		}
+	}
+	*c = valueCell(value)
+	return nil
+}
+
+// isConditions reports whether a JSON array is an array of TableConditions
+func isConditions(values []interface{}) bool {
+	for _, value := range values {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, exists := obj["operator"]; !exists {
+			return false
+		}
+	}
+	return len(values) > 0
+}
+
+// ParseDecisionTable decodes a decision table written in JSON, YAML or TOML, errors are
+// SourceErrors matching ErrInvalidRules
+func ParseDecisionTable(data []byte, format Format) (DecisionTable, error) {
+	if format == FormatExpression {
+		return DecisionTable{}, fmt.Errorf("%w: a decision table can not be written as an expression", ErrInvalidRules)
+	}
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return DecisionTable{}, err
+	}
+	if format != FormatJSON {
+		if data, err = json.Marshal(doc.value); err != nil {
+			return DecisionTable{}, doc.errorAt("", fmt.Errorf("%w: %w", ErrInvalidRules, err))
+		}
+	}
+	var table DecisionTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return DecisionTable{}, doc.errorAt("", fmt.Errorf("%w: %w", ErrInvalidRules, err))
+	}
+	return table, nil
+}
+
+// ReadDecisionTableCSV reads a decision table written as CSV. The header names the inputs by
+// their fields and the outputs with a "=>" prefix, e.g. "country,amount,=> fee", a "@priority"
+// column holds the priorities of the rows. Every other line is a row, its input cells are
+// parsed like the text of a TableCell and its outputs are JSON values, or strings. An empty
+// output leaves the output out. Errors are SourceErrors locating the offending cell.
+func ReadDecisionTableCSV(r io.Reader, hitPolicy HitPolicy) (DecisionTable, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return DecisionTable{}, csvError(err)
+	}
+
+	table := DecisionTable{HitPolicy: hitPolicy}
+	priority := -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "@priority":
+			priority = i
+		case strings.HasPrefix(name, "=>"):
+			table.Outputs = append(table.Outputs, strings.TrimSpace(strings.TrimPrefix(name, "=>")))
+		case name == "":
+			return DecisionTable{}, &SourceError{Format: formatCSV, Line: 1, Column: i + 1, Err: fmt.Errorf("%w: the header of column %d is empty", ErrInvalidRules, i+1)}
+		default:
+			table.Inputs = append(table.Inputs, name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return DecisionTable{}, csvError(err)
+		}
+		row := TableRow{Inputs: []TableCell{}, Outputs: []interface{}{}}
+		path := fmt.Sprintf("rows[%d]", len(table.Rows))
+		for i, text := range record {
+			line, column := reader.FieldPos(i)
+			text = strings.TrimSpace(text)
+			name := strings.TrimSpace(header[i])
+			switch {
+			case i == priority:
+				if text != "" {
+					if row.Priority, err = strconv.Atoi(text); err != nil {
+						return DecisionTable{}, &SourceError{Format: formatCSV, Line: line, Column: column, Path: path + ".priority", Err: fmt.Errorf("%w: invalid priority %q", ErrInvalidRules, text)}
+					}
+				}
+			case strings.HasPrefix(name, "=>"):
+				var value interface{}
+				if text != "" {
+					value = parseCellValue(text)
+				}
+				row.Outputs = append(row.Outputs, value)
+			default:
+				cell, err := parseTableCell(text)
+				if err != nil {
+					return DecisionTable{}, &SourceError{Format: formatCSV, Line: line, Column: column, Path: fmt.Sprintf("%s.inputs[%d]", path, len(row.Inputs)), Err: err}
+				}
+				row.Inputs = append(row.Inputs, cell)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// csvError locates an error of the CSV reader
+func csvError(err error) error {
+	e := &SourceError{Format: formatCSV, Err: fmt.Errorf("%w: %w", ErrInvalidRules, err)}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		e.Line, e.Column = parseErr.Line, parseErr.Column
+		e.Err = fmt.Errorf("%w: %w", ErrInvalidRules, parseErr.Err)
+	}
+	return e
+}
+
+// TableProgram is a compiled DecisionTable, it can be evaluated many times from many goroutines
+type TableProgram struct {
+	table DecisionTable
+	// program holds the evaluation settings of the rows
+	program *Program
+	// rows are the condition sets of the rows
+	rows []*compiledGroup
+	// cells are the compiled conditions of every cell, by row and input
+	cells [][][]*compiledRule
+}
+
+// CompileTable compiles every row of the table into a condition set, a cell compiles into
+// rules on the field of its input
+func CompileTable(table DecisionTable, opts ...Option) (*TableProgram, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch table.HitPolicy {
+	case "":
+		table.HitPolicy = HitUnique
+	case HitUnique, HitFirst, HitPriority, HitCollect:
+	default:
+		return nil, fmt.Errorf("%w: unknown hit policy %q", ErrInvalidRules, table.HitPolicy)
+	}
+
+	p := &TableProgram{table: table, program: &Program{parallelism: o.parallelism, clock: o.clock}}
+	for i, row := range table.Rows {
+		path := fmt.Sprintf("rows[%d]", i)
+		if len(row.Inputs) != len(table.Inputs) {
+			return nil, fmt.Errorf("%w: %s has %d inputs, the table has %d", ErrInvalidRules, path, len(row.Inputs), len(table.Inputs))
+		}
+		if len(row.Outputs) != len(table.Outputs) {
+			return nil, fmt.Errorf("%w: %s has %d outputs, the table has %d", ErrInvalidRules, path, len(row.Outputs), len(table.Outputs))
+		}
+
+		group := &compiledGroup{kind: TraceConditionSet, path: path}
+		cells := make([][]*compiledRule, len(row.Inputs))
+		for j, cell := range row.Inputs {
+			for _, condition := range cell {
+				rule := Rule{Field: table.Inputs[j], Operator: condition.Operator, Value: condition.Value}
+				r := compileRule(rule, fmt.Sprintf("%s.inputs[%d]", path, j), &o)
+				if r.err != nil {
+					return nil, r.err
+				}
+				cells[j] = append(cells[j], r)
+				group.all = append(group.all, r)
+			}
+		}
+		p.rows = append(p.rows, group)
+		p.cells = append(p.cells, cells)
+	}
+	return p, nil
+}
+
+// Table returns the table the program was compiled from, with its default hit policy
+func (p *TableProgram) Table() DecisionTable {
+	return p.table
+}
+
+// Evaluate evaluates the rows against a JSON string, a map or a struct and returns the
+// matching rows selected by the hit policy
+func (p *TableProgram) Evaluate(input interface{}) ([]TableMatch, error) {
+	return p.EvaluateContext(context.Background(), input)
+}
+
+// EvaluateContext evaluates the rows like Evaluate does, the evaluation stops with the error
+// of the context once it is cancelled or its deadline is exceeded. A row failing with an
+// error fails the evaluation, more than one row matching a table with the unique hit policy
+// is an ErrHitPolicyViolation.
+func (p *TableProgram) EvaluateContext(ctx context.Context, input interface{}) ([]TableMatch, error) {
+	e, err := p.program.evaluation(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []int
+	for i, row := range p.rows {
+		passed, err := row.eval(e, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !passed {
+			continue
+		}
+		matched = append(matched, i)
+		if p.table.HitPolicy == HitFirst {
+			break
+		}
+	}
+
+	switch p.table.HitPolicy {
+	case HitUnique:
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("%w: rows %s match", ErrHitPolicyViolation, describeRows(matched))
+		}
+	case HitPriority:
+		if len(matched) > 1 {
+			best := matched[0]
+			for _, i := range matched[1:] {
+				if p.table.Rows[i].Priority > p.table.Rows[best].Priority {
+					best = i
+				}
+			}
+			matched = []int{best}
+		}
+	}
+
+	matches := make([]TableMatch, 0, len(matched))
+	for _, i := range matched {
+		matches = append(matches, p.match(i))
+	}
+	return matches, nil
+}
+
+// match returns the outputs of a row
+func (p *TableProgram) match(row int) TableMatch {
+	outputs := map[string]interface{}{}
+	for i, value := range p.table.Rows[row].Outputs {
+		if value != nil {
+			outputs[p.table.Outputs[i]] = value
+		}
+	}
+	return TableMatch{Row: row, Outputs: outputs}
+}
+
+// describeRows lists row indexes for error messages, e.g. "0, 2 and 3"
+func describeRows(rows []int) string {
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, strconv.Itoa(row))
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// maxTableChecks bounds the combinations of input values Check evaluates
+const maxTableChecks = 100000
+
+// maxTableGaps bounds the gaps Check lists, the others are only counted
+const maxTableGaps = 50
+
+// TableReport lists the overlapping and missing rows of a decision table
+type TableReport struct {
+	// Overlaps are the sets of rows matching the same input
+	Overlaps []TableOverlap `json:"overlaps,omitempty"`
+	// Gaps are inputs matching no row, keyed by the fields of the inputs
+	Gaps []map[string]interface{} `json:"gaps,omitempty"`
+	// OmittedGaps counts the gaps found past the first ones, which are not listed
+	OmittedGaps int `json:"omittedGaps,omitempty"`
+	// Truncated is set when the table has too many combinations of values to check them all
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// TableOverlap is a set of rows matching the same input
+type TableOverlap struct {
+	Rows []int `json:"rows"`
+	// Input is an input the rows match, keyed by the fields of the inputs
+	Input map[string]interface{} `json:"input"`
+}
+
+// Check looks for rows matching the same input, which tables with the unique hit policy must
+// not have, and for inputs no row matches. It evaluates the cells against the values of the
+// cells of every input, the numbers between and around them and a string none of them holds,
+// so the overlaps and gaps it reports are real but cells using other operators than
+// comparisons, e.g. regex or custom operators, may hide some. An input whose cells only hold
+// integers is taken to be an integer, so "<= 100" and ">= 101" leave no gap.
+func (p *TableProgram) Check() TableReport {
+	var report TableReport
+	samples := make([][]interface{}, len(p.table.Inputs))
+	combinations := 1
+	for i := range p.table.Inputs {
+		samples[i] = p.samples(i)
+		combinations *= len(samples[i])
+		if combinations > maxTableChecks {
+			combinations = maxTableChecks
+			report.Truncated = true
+		}
+	}
+
+	// matches[row][input][sample] tells whether the cell of the row matches the sample
+	ctx := context.Background()
+	matches := make([][][]bool, len(p.rows))
+	for row := range p.rows {
+		matches[row] = make([][]bool, len(samples))
+		for input, values := range samples {
+			matches[row][input] = make([]bool, len(values))
+			for k, value := range values {
+				matches[row][input][k] = cellMatches(ctx, p.cells[row][input], value)
+			}
+		}
+	}
+
+	overlaps := map[string]int{}
+	indexes := make([]int, len(samples))
+	for n := 0; n < combinations; n++ {
+		var rows []int
+		for row := range p.rows {
+			matched := true
+			for input, k := range indexes {
+				if !matches[row][input][k] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				rows = append(rows, row)
+			}
+		}
+
+		switch {
+		case len(rows) == 0 && len(report.Gaps) == maxTableGaps:
+			report.OmittedGaps++
+		case len(rows) == 0:
+			report.Gaps = append(report.Gaps, p.sampleInput(samples, indexes))
+		case len(rows) > 1:
+			key := fmt.Sprint(rows)
+			if _, exists := overlaps[key]; !exists {
+				overlaps[key] = len(report.Overlaps)
+				report.Overlaps = append(report.Overlaps, TableOverlap{Rows: rows, Input: p.sampleInput(samples, indexes)})
+			}
+		}
+
+		// move to the next combination, the last input changes fastest
+		for input := len(indexes) - 1; input >= 0; input-- {
+			indexes[input]++
+			if indexes[input] < len(samples[input]) {
+				break
+			}
+			indexes[input] = 0
+		}
+	}
+	return report
+}
+
+// samples returns the values Check evaluates the cells of an input against
+func (p *TableProgram) samples(input int) []interface{} {
+	var numbers []float64
+	var values []interface{}
+	seen := map[string]bool{}
+	hasStrings, hasBools := false, false
+	var add func(value interface{})
+	add = func(value interface{}) {
+		if isList(value) {
+			list := reflect.ValueOf(value)
+			for i := 0; i < list.Len(); i++ {
+				add(list.Index(i).Interface())
+			}
+			return
+		}
+		if _, ok := value.(string); !ok {
+			if n, ok := toNumber(value, false); ok {
+				numbers = append(numbers, n.float())
+				return
+			}
+		}
+		switch value.(type) {
+		case string:
+			hasStrings = true
+		case bool:
+			hasBools = true
+			return
+		}
+		if key := formatValue(value); !seen[key] {
+			seen[key] = true
+			values = append(values, value)
+		}
+	}
+	for _, row := range p.table.Rows {
+		for _, condition := range row.Inputs[input] {
+			add(condition.Value)
+		}
+	}
+
+	sort.Float64s(numbers)
+	numbers = slices.Compact(numbers)
+	integers := true
+	for _, n := range numbers {
+		integers = integers && n == math.Trunc(n)
+	}
+	for i, n := range numbers {
+		if i == 0 {
+			values = append(values, n-1)
+		}
+		values = append(values, n)
+		switch {
+		case i == len(numbers)-1:
+			values = append(values, n+1)
+		case !integers:
+			values = append(values, n+(numbers[i+1]-n)/2)
+		case numbers[i+1]-n > 1:
+			// the integers between two bounds match the same cells, one of them stands for all
+			values = append(values, n+1)
+		}
+	}
+	if hasBools {
+		values = append(values, true, false)
+	}
+	if hasStrings || len(values) == 0 {
+		other := "other"
+		for i := 2; seen[formatValue(other)]; i++ {
+			other = "other" + strconv.Itoa(i)
+		}
+		values = append(values, other)
+	}
+	return values
+}
+
+// sampleInput builds the input of a combination of samples
+func (p *TableProgram) sampleInput(samples [][]interface{}, indexes []int) map[string]interface{} {
+	input := make(map[string]interface{}, len(indexes))
+	for i, k := range indexes {
+		input[p.table.Inputs[i]] = samples[i][k]
+	}
+	return input
+}
+
+// cellMatches reports whether every condition of a cell passes for the value, an error fails it
+func cellMatches(ctx context.Context, conditions []*compiledRule, value interface{}) bool {
+	for _, r := range conditions {
+		var result bool
+		var err error
+		switch {
+		case r.custom != nil:
+			var output interface{}
+			output, err = executeCustom(ctx, r.custom, value, r.rule.Value)
+			result = output == true
+		default:
+			result, err = r.apply(value)
+		}
+		if err != nil || !result {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const feeTableCSV = `country, tier, amount, => fee, => currency
+TR, gold, [0..1000), 1.5, TRY
+TR, gold, >= 1000, 1, TRY
+TR, silver, -, 2.5, TRY
+"in [""DE"",""FR""]", -, -, 2, EUR
+`
+
+func compileFeeTable(t *testing.T, policy HitPolicy, extra string) *TableProgram {
+	t.Helper()
+	table, err := ReadDecisionTableCSV(strings.NewReader(feeTableCSV+extra), policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	program, err := CompileTable(table)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return program
+}
+
+func TestReadDecisionTableCSV(t *testing.T) {
+	table, err := ReadDecisionTableCSV(strings.NewReader(feeTableCSV), HitUnique)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(table.Inputs, []string{"country", "tier", "amount"}) || !reflect.DeepEqual(table.Outputs, []string{"fee", "currency"}) || len(table.Rows) != 4 {
+		t.Fatalf("table = %+v", table)
+	}
+
+	cells := map[string]TableCell{
+		"TR":          {{Operator: "equals", Value: "TR"}},
+		"[0..1000)":   {{Operator: "greaterThanInclusive", Value: 0.0}, {Operator: "lessThan", Value: 1000.0}},
+		">= 1000":     {{Operator: "greaterThanInclusive", Value: 1000.0}},
+		"-":           nil,
+		`["DE","FR"]`: {{Operator: "in", Value: []interface{}{"DE", "FR"}}},
+	}
+	row := table.Rows[0]
+	for text, cell := range map[string]TableCell{"TR": row.Inputs[0], "[0..1000)": row.Inputs[2], ">= 1000": table.Rows[1].Inputs[2], "-": table.Rows[2].Inputs[2], `["DE","FR"]`: table.Rows[3].Inputs[0]} {
+		if !reflect.DeepEqual(cell, cells[text]) {
+			t.Errorf("cell %s = %+v; expected %+v", text, cell, cells[text])
+		}
+		if cell.String() != text {
+			t.Errorf("String() = %q; expected %q", cell.String(), text)
+		}
+	}
+	if !reflect.DeepEqual(row.Outputs, []interface{}{1.5, "TRY"}) {
+		t.Errorf("outputs = %v", row.Outputs)
+	}
+
+	// text starting with a word that is not an operator is a string
+	for text, expected := range map[string]TableCell{
+		"Route 66":      {{Operator: "equals", Value: "Route 66"}},
+		"in [1, 2]":     {{Operator: "in", Value: []interface{}{1.0, 2.0}}},
+		"custom.near 5": {{Operator: "custom.near", Value: 5.0}},
+	} {
+		cell, err := parseTableCell(text)
+		if err != nil || !reflect.DeepEqual(cell, expected) {
+			t.Errorf("parseTableCell(%q) = %+v, %v; expected %+v", text, cell, err, expected)
+		}
+	}
+	routes, err := ReadDecisionTableCSV(strings.NewReader("road, => fee\nRoute 66, 1\n"), HitUnique)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	program, err := CompileTable(routes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matches, err := program.Evaluate(map[string]interface{}{"road": "Route 66"}); err != nil || len(matches) != 1 {
+		t.Errorf("Evaluate = %+v, %v; expected the row to match", matches, err)
+	}
+	if text := (TableCell{{Operator: "route", Value: 66.0}}).String(); text != `[{"operator":"route","value":66}]` {
+		t.Errorf("String() = %s; expected an unknown operator to be written as JSON", text)
+	}
+
+	_, err = ReadDecisionTableCSV(strings.NewReader("tier, @priority, => fee\ngold, high, 1\n"), HitPriority)
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) || sourceErr.Line != 2 || sourceErr.Column != 7 || sourceErr.Path != "rows[0].priority" || !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error locating the priority; got %v", err)
+	}
+	if _, err := ReadDecisionTableCSV(strings.NewReader("tier, => fee\ngold\n"), HitUnique); !errors.As(err, &sourceErr) || sourceErr.Line != 2 {
+		t.Errorf("expected an error for a short row; got %v", err)
+	}
+}
+
+func TestParseDecisionTable(t *testing.T) {
+	documents := map[Format]string{
+		FormatJSON: `{"hitPolicy": "collect", "inputs": ["tier", "amount"], "outputs": ["fee"], "rows": [
+			{"inputs": ["gold", [{"operator": "greaterThan", "value": 10}, {"operator": "notEquals", "value": 50}]], "outputs": [1]},
+			{"inputs": [["gold", "silver"], null], "outputs": [2], "priority": 1}
+		]}`,
+		FormatYAML: `
+hitPolicy: collect
+inputs: [tier, amount]
+outputs: [fee]
+rows:
+  - inputs: [gold, [{operator: greaterThan, value: 10}, {operator: notEquals, value: 50}]]
+    outputs: [1]
+  - inputs: [[gold, silver], "-"]
+    outputs: [2]
+    priority: 1
+`,
+	}
+	for format, document := range documents {
+		table, err := ParseDecisionTable([]byte(document), format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if table.HitPolicy != HitCollect || len(table.Rows) != 2 || len(table.Rows[0].Inputs[1]) != 2 || table.Rows[1].Inputs[1] != nil || table.Rows[1].Priority != 1 {
+			t.Errorf("%s: table = %+v", format, table)
+		}
+		if cell := table.Rows[1].Inputs[0]; len(cell) != 1 || cell[0].Operator != "in" {
+			t.Errorf("%s: cell = %+v; expected an array to be compared with in", format, cell)
+		}
+
+		data, err := json.Marshal(table)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		parsed, err := ParseDecisionTable(data, FormatJSON)
+		if err != nil || !reflect.DeepEqual(parsed, table) {
+			t.Errorf("%s: marshalled table %s parses to %+v, %v", format, data, parsed, err)
+		}
+	}
+
+	if _, err := ParseDecisionTable([]byte(`a == 1`), FormatExpression); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for an expression; got %v", err)
+	}
+}
+
+func TestTableHitPolicies(t *testing.T) {
+	input := map[string]interface{}{"country": "TR", "tier": "gold", "amount": 5000}
+
+	matches, err := compileFeeTable(t, HitUnique, "").Evaluate(input)
+	expected := []TableMatch{{Row: 1, Outputs: map[string]interface{}{"fee": 1.0, "currency": "TRY"}}}
+	if err != nil || !reflect.DeepEqual(matches, expected) {
+		t.Errorf("unique = %+v, %v; expected %+v", matches, err, expected)
+	}
+
+	// the extra row overlaps the second one for large amounts
+	extra := "-, -, > 2000, 0.5, \n"
+	if _, err := compileFeeTable(t, HitUnique, extra).Evaluate(input); !errors.Is(err, ErrHitPolicyViolation) || !strings.Contains(err.Error(), "rows 1 and 4 match") {
+		t.Errorf("expected a hit policy violation; got %v", err)
+	}
+
+	matches, err = compileFeeTable(t, HitFirst, extra).Evaluate(input)
+	if err != nil || len(matches) != 1 || matches[0].Row != 1 {
+		t.Errorf("first = %+v, %v; expected the second row", matches, err)
+	}
+
+	matches, err = compileFeeTable(t, HitCollect, extra).Evaluate(input)
+	if err != nil || len(matches) != 2 || matches[1].Row != 4 || !reflect.DeepEqual(matches[1].Outputs, map[string]interface{}{"fee": 0.5}) {
+		t.Errorf("collect = %+v, %v; expected both rows without the empty output", matches, err)
+	}
+
+	table, _ := ReadDecisionTableCSV(strings.NewReader("tier, @priority, => fee\ngold, 1, 1\n-, 5, 2\n-, 5, 3\n"), HitPriority)
+	program, err := CompileTable(table)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matches, err = program.Evaluate(`{"tier": "gold"}`)
+	if err != nil || len(matches) != 1 || matches[0].Row != 1 {
+		t.Errorf("priority = %+v, %v; expected the first row with the highest priority", matches, err)
+	}
+
+	if matches, err := compileFeeTable(t, HitUnique, "").Evaluate(`{"country": "US", "tier": "gold", "amount": 1}`); err != nil || len(matches) != 0 {
+		t.Errorf("matches = %+v, %v; expected no match", matches, err)
+	}
+	if _, err := compileFeeTable(t, HitUnique, "").Evaluate(`{"country": "TR", "tier": "gold"}`); !errors.Is(err, ErrMissingField) {
+		t.Errorf("expected the missing field; got %v", err)
+	}
+}
+
+func TestCompileTableErrors(t *testing.T) {
+	table := DecisionTable{
+		Inputs:  []string{"tier"},
+		Outputs: []string{"fee"},
+		Rows:    []TableRow{{Inputs: []TableCell{{{Operator: "nope", Value: 1}}}, Outputs: []interface{}{1}}},
+	}
+	var ruleErr *RuleError
+	if _, err := CompileTable(table); !errors.Is(err, ErrUnknownOperator) || !errors.As(err, &ruleErr) || ruleErr.Path != "rows[0].inputs[0]" {
+		t.Errorf("expected the unknown operator of the cell; got %v", err)
+	}
+
+	table.Rows[0].Inputs = nil
+	if _, err := CompileTable(table); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for a row without inputs; got %v", err)
+	}
+	table.HitPolicy = "any"
+	if _, err := CompileTable(table); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("expected an error for an unknown hit policy; got %v", err)
+	}
+}
+
+func TestTableCheck(t *testing.T) {
+	table, err := ReadDecisionTableCSV(strings.NewReader(`tier, amount, => fee
+gold, [0..1000), 1
+gold, [1000..5000], 2
+gold, > 4000, 3
+silver, -, 4
+`), HitUnique)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	program, err := CompileTable(table)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := program.Check()
+	if report.Truncated || len(report.Overlaps) != 1 || !reflect.DeepEqual(report.Overlaps[0].Rows, []int{1, 2}) {
+		t.Fatalf("overlaps = %+v; expected the second and third rows", report.Overlaps)
+	}
+	if amount := report.Overlaps[0].Input["amount"].(float64); amount <= 4000 || amount > 5000 {
+		t.Errorf("overlap input = %v; expected an amount both rows match", report.Overlaps[0].Input)
+	}
+
+	gaps := map[string]bool{}
+	for _, gap := range report.Gaps {
+		if gap["tier"] == "gold" {
+			gaps["gold"] = true
+			if amount := gap["amount"].(float64); amount >= 0 {
+				t.Errorf("gap = %v; expected negative amounts only for gold", gap)
+			}
+		} else {
+			gaps[gap["tier"].(string)] = true
+		}
+	}
+	if !gaps["gold"] || !gaps["other"] || gaps["silver"] {
+		t.Errorf("gaps = %v; expected negative gold amounts and other tiers", report.Gaps)
+	}
+
+	if report := compileFeeTable(t, HitFirst, "-, -, -, 0, \n").Check(); len(report.Gaps) != 0 || len(report.Overlaps) == 0 {
+		t.Errorf("report = %+v; expected a catch-all row to fill every gap", report)
+	}
+
+	// integer bounds only leave gaps between integers
+	for csv, gap := range map[string]interface{}{
+		"amount, => fee\n<= 100, 1\n>= 101, 2\n":   nil,
+		"amount, => fee\n<= 100, 1\n>= 102, 2\n":   101.0,
+		"amount, => fee\n<= 100, 1\n>= 100.5, 2\n": 100.25,
+	} {
+		table, err := ReadDecisionTableCSV(strings.NewReader(csv), HitUnique)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		program, err := CompileTable(table)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		report := program.Check()
+		switch {
+		case gap == nil && len(report.Gaps) != 0:
+			t.Errorf("%q: gaps = %v; expected none", csv, report.Gaps)
+		case gap != nil && (len(report.Gaps) != 1 || report.Gaps[0]["amount"] != gap):
+			t.Errorf("%q: gaps = %v; expected a gap at %v", csv, report.Gaps, gap)
+		}
+	}
+
+	// a wide table lists the first gaps and counts the others
+	csv := "a, b, => fee\n"
+	for i := 0; i < 10; i++ {
+		csv += fmt.Sprintf("v%d, v%d, %d\n", i, i, i)
+	}
+	table, err = ReadDecisionTableCSV(strings.NewReader(csv), HitUnique)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	program, err = CompileTable(table)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// every value of both inputs and a value none of them holds leave 11 * 11 - 10 gaps
+	if report := program.Check(); len(report.Gaps) != maxTableGaps || report.OmittedGaps != 11*11-10-maxTableGaps {
+		t.Errorf("report = %d gaps, %d omitted; expected %d and %d", len(report.Gaps), report.OmittedGaps, maxTableGaps, 11*11-10-maxTableGaps)
+	}
+}
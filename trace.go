@@ -0,0 +1,240 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kinds of Trace nodes
+const (
+	TraceRuleSet      = "ruleSet"
+	TraceConditionSet = "conditionSet"
+	TraceGroup        = "group"
+	TraceAll          = "all"
+	TraceAny          = "any"
+	TraceNone         = "none"
+	TraceNot          = "not"
+	TraceRule         = "rule"
+)
+
+// Trace is the outcome of evaluating a rule set, a condition set, a group or a single rule
+type Trace struct {
+	Kind string `json:"kind"`
+	// Path is the location in the RuleSet, e.g. "conditions[0].all[1]"
+	Path       string      `json:"path,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Version    string      `json:"version,omitempty"`
+	Field      string      `json:"field,omitempty"`
+	Operator   string      `json:"operator,omitempty"`
+	FieldValue interface{} `json:"fieldValue,omitempty"`
+	RuleValue  interface{} `json:"ruleValue,omitempty"`
+	Result     bool        `json:"result"`
+	// Weight is the weight of the node, Score is the score of a rule set in scoring mode
+	Weight float64  `json:"weight,omitempty"`
+	Score  *float64 `json:"score,omitempty"`
+	// Skipped is set when the node was not evaluated because the outcome was already known,
+	// or along with Inactive because it is outside its effective window
+	Skipped  bool     `json:"skipped,omitempty"`
+	Inactive bool     `json:"inactive,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Children []*Trace `json:"children,omitempty"`
+}
+
+// String renders the trace as an indented text report
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return b.String()
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(b, "%-6s", strings.ToUpper(t.status()))
+	b.WriteString(t.describe())
+	b.WriteString("\n")
+
+	for _, child := range t.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// status is the outcome of the node: pass, fail, skip or error
+func (t *Trace) status() string {
+	switch {
+	case t.Error != "":
+		return "error"
+	case t.Skipped:
+		return "skip"
+	case t.Result:
+		return "pass"
+	}
+	return "fail"
+}
+
+// describe renders the node without its outcome
+func (t *Trace) describe() string {
+	var b strings.Builder
+	switch t.Kind {
+	case TraceRuleSet:
+		b.WriteString("rule set")
+		t.describeMetadata(&b)
+	case TraceConditionSet:
+		b.WriteString("condition set " + t.Path)
+	case TraceGroup:
+		b.WriteString("group " + t.Path)
+		t.describeMetadata(&b)
+	case TraceAll, TraceAny, TraceNone:
+		b.WriteString(t.Kind + " of")
+	case TraceNot:
+		b.WriteString("not")
+	case TraceRule:
+		fmt.Fprintf(&b, "%s %s %s", t.Field, t.Operator, formatValue(t.RuleValue))
+		if !t.Skipped && t.Error == "" {
+			fmt.Fprintf(&b, " (actual %s)", formatValue(t.FieldValue))
+		}
+		fmt.Fprintf(&b, " [%s]", t.Path)
+		t.describeMetadata(&b)
+	}
+	if t.Weight != 0 {
+		fmt.Fprintf(&b, " (weight %g)", t.Weight)
+	}
+	if t.Score != nil {
+		fmt.Fprintf(&b, " (score %g)", *t.Score)
+	}
+	if t.Inactive {
+		b.WriteString(" (outside its effective window)")
+	}
+	if t.Error != "" {
+		b.WriteString(": " + t.Error)
+	}
+	return b.String()
+}
+
+// describeMetadata renders the id and the version of the node, e.g. " gold@3"
+func (t *Trace) describeMetadata(b *strings.Builder) {
+	if t.ID != "" {
+		b.WriteString(" " + t.ID)
+	}
+	if t.Version != "" {
+		b.WriteString("@" + t.Version)
+	}
+}
+
+// formatValue renders a value of a rule the way it is written in JSON
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// The helpers below accept a nil trace, so evaluation does not pay for tracing unless it is asked for
+
+func (t *Trace) visit() {
+	if t != nil {
+		t.Skipped = false
+	}
+}
+
+func (t *Trace) pass() bool {
+	if t != nil {
+		t.Result = true
+	}
+	return true
+}
+
+func (t *Trace) fail(err error) error {
+	if t != nil {
+		t.Result = false
+		if err != nil && (t.Kind == TraceRule || t.Kind == TraceRuleSet) {
+			t.Error = err.Error()
+		}
+	}
+	return err
+}
+
+func (t *Trace) deactivate() {
+	if t != nil {
+		t.Skipped = true
+		t.Inactive = true
+		t.Result = false
+	}
+}
+
+func (t *Trace) setScore(score float64) {
+	if t != nil {
+		t.Score = &score
+	}
+}
+
+func (t *Trace) setFieldValue(value interface{}) {
+	if t != nil {
+		t.FieldValue = value
+	}
+}
+
+func (t *Trace) child(i int) *Trace {
+	if t == nil {
+		return nil
+	}
+	return t.Children[i]
+}
+
+// part returns the all/any/none/not child of a group
+func (t *Trace) part(kind string) *Trace {
+	if t == nil {
+		return nil
+	}
+	for _, child := range t.Children {
+		if child.Kind == kind {
+			return child
+		}
+	}
+	return nil
+}
+
+// trace returns the trace of the program before it is evaluated
+func (p *Program) trace() *Trace {
+	t := &Trace{Kind: TraceRuleSet, ID: p.ruleSet.ID, Version: p.ruleSet.Version, Skipped: true}
+	for _, conditionSet := range p.conditions {
+		t.Children = append(t.Children, conditionSet.trace())
+	}
+	return t
+}
+
+func (g *compiledGroup) trace() *Trace {
+	t := &Trace{Kind: g.kind, Path: g.path, ID: g.metadata.ID, Version: g.metadata.Version, Weight: g.weight, Skipped: true}
+	part := func(kind, path string, nodes []node) {
+		if len(nodes) == 0 {
+			return
+		}
+		p := &Trace{Kind: kind, Path: path, Skipped: true}
+		for _, n := range nodes {
+			p.Children = append(p.Children, n.trace())
+		}
+		t.Children = append(t.Children, p)
+	}
+	part(TraceAll, g.path+".all", g.all)
+	part(TraceAny, g.path+".any", g.any)
+	part(TraceNone, g.path+".none", g.none)
+	if g.not != nil {
+		part(TraceNot, g.path+".not", []node{g.not})
+	}
+	return t
+}
+
+func (r *compiledRule) trace() *Trace {
+	return &Trace{
+		Kind:      TraceRule,
+		Path:      r.path,
+		ID:        r.rule.ID,
+		Version:   r.rule.Version,
+		Field:     r.rule.Field,
+		Operator:  r.rule.Operator,
+		RuleValue: r.rule.Value,
+		Weight:    r.rule.Weight,
+		Skipped:   true,
+	}
+}
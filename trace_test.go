@@ -0,0 +1,103 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgramExplain(t *testing.T) {
+	rules := `{
+	   "conditions":[
+		  {
+			 "all":[
+				{
+				   "field":"country",
+				   "operator":"equals",
+				   "value":"Turkey"
+				},
+				{
+				   "field":"population",
+				   "operator":"greaterThan",
+				   "value":1000
+				},
+				{
+				   "field":"city",
+				   "operator":"equals",
+				   "value":"Istanbul"
+				}
+			 ],
+			 "any":[
+				{
+				   "field":"language",
+				   "operator":"equals",
+				   "value":"Turkish"
+				}
+			 ]
+		  }
+	   ]
+	}`
+
+	program, err := Compile(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trace, err := program.Explain(`{"country":"Turkey","population":10,"city":"Istanbul","language":"Turkish"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `FAIL  rule set
+  FAIL  condition set conditions[0]
+    FAIL  all of
+      PASS  country equals "Turkey" (actual "Turkey") [conditions[0].all[0]]
+      FAIL  population greaterThan 1000 (actual 10) [conditions[0].all[1]]
+      SKIP  city equals "Istanbul" [conditions[0].all[2]]
+    SKIP  any of
+      SKIP  language equals "Turkish" [conditions[0].any[0]]
+`
+	if trace.String() != expected {
+		t.Errorf("trace = \n%s\nexpected\n%s", trace, expected)
+	}
+
+	rule := trace.Children[0].Children[0].Children[1]
+	if rule.Field != "population" || rule.FieldValue != 10.0 || rule.RuleValue != 1000.0 || rule.Result || rule.Skipped {
+		t.Errorf("rule trace = %+v", rule)
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Trace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.String() != expected {
+		t.Errorf("decoded trace = \n%s\nexpected\n%s", decoded.String(), expected)
+	}
+}
+
+func TestProgramExplainWithError(t *testing.T) {
+	rules := `{"conditions":[{"any":[{"field":"country","operator":"equals","value":"Turkey"},{"not":{"field":"city","operator":"equals","value":"Ankara"}}]}]}`
+
+	program, err := Compile(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trace, err := program.Explain(`{"country":"England"}`)
+	if !errors.Is(err, ErrMissingField) {
+		t.Fatalf("error = %v; expected %v", err, ErrMissingField)
+	}
+
+	rule := trace.Children[0].Children[0].Children[1].Children[0].Children[0]
+	if rule.Path != "conditions[0].any[1].not" || !strings.Contains(rule.Error, "missing field") {
+		t.Errorf("rule trace = %+v", rule)
+	}
+	if !strings.Contains(trace.String(), `ERROR city equals "Ankara" [conditions[0].any[1].not]: `) {
+		t.Errorf("trace = \n%s", trace)
+	}
+}
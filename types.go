@@ -0,0 +1,76 @@
+package rule
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Type is the type of a field value or a rule value
+type Type string
+
+const (
+	TypeAny    Type = "any"
+	TypeNull   Type = "null"
+	TypeString Type = "string"
+	TypeNumber Type = "number"
+	TypeBool   Type = "boolean"
+	TypeArray  Type = "array"
+	TypeObject Type = "object"
+	// TypeTime accepts anything the date and time operators can parse as a time
+	TypeTime Type = "time"
+)
+
+// Accepts reports whether value is of the type
+func (t Type) Accepts(value interface{}) bool {
+	switch t {
+	case TypeAny:
+		return true
+	case TypeNull:
+		return value == nil
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeNumber:
+		return isNumber(value)
+	case TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case TypeArray:
+		return isList(value)
+	case TypeObject:
+		// a struct, or a pointer to one, is an object rules read the fields of, like a map
+		object := reflectValue(reflect.ValueOf(value))
+		if _, isTime := object.(time.Time); isTime || object == nil {
+			return false
+		}
+		kind := reflect.TypeOf(object).Kind()
+		return kind == reflect.Map || kind == reflect.Struct
+	case TypeTime:
+		_, ok := parseTime(value)
+		return ok
+	}
+	return false
+}
+
+// acceptsAny reports whether value is of any of the types, no types accept anything
+func acceptsAny(types []Type, value interface{}) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t.Accepts(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTypes joins types for error messages, e.g. "number or string"
+func describeTypes(types []Type) string {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, string(t))
+	}
+	return strings.Join(names, " or ")
+}
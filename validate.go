@@ -0,0 +1,264 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Severity is the importance of a Diagnostic
+type Severity string
+
+const (
+	// SeverityError marks a rule that can not be evaluated, Compile rejects the rule set
+	SeverityError Severity = "error"
+	// SeverityWarning marks a rule set that compiles but is likely to be wrong
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found in a rule set by Validate
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// Path is the location of the problem in the RuleSet, e.g. "conditions[0].all[1]"
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Err is the error of the rule of an error diagnostic, it can be matched with errors.Is
+	Err error `json:"-"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Path, d.Message)
+}
+
+// Diagnostics are the problems found by Validate, in the order of the rule set
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether any of the diagnostics is an error
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a rule set without evaluating it, using the options Compile would be
+// given. Rules Compile rejects, e.g. unknown operators, custom operations missing from
+// WithCustom and invalid rule values, are errors. Empty condition sets and groups,
+// contradictory rules in the same "all" and duplicate rules are warnings.
+func Validate(ruleSet RuleSet, opts ...Option) Diagnostics {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	v := &validator{o: &o}
+	if err := ruleSet.checkWindow(); err != nil {
+		v.fail("", err)
+	}
+	if len(ruleSet.Conditions) == 0 {
+		v.warn("", "the rule set has no conditions, it always passes")
+	}
+	weighted := false
+	for _, conditionSet := range ruleSet.Conditions {
+		weighted = weighted || conditionSet.Weight != 0 || anyRule(conditionRules(conditionSet), func(rule Rule) bool { return rule.Weight != 0 })
+	}
+	switch {
+	case ruleSet.Scoring != nil && !weighted:
+		v.warn("scoring", "no rule has a weight, the score is always 0")
+	case ruleSet.Scoring == nil && weighted:
+		v.warn("", "weights are only used in scoring mode, the rule set has no scoring")
+	}
+	for i, conditionSet := range ruleSet.Conditions {
+		v.group("condition set", conditionSet.All, conditionSet.Any, conditionSet.None, conditionSet.Not, fmt.Sprintf("conditions[%d]", i))
+	}
+	return v.diagnostics
+}
+
+// validator collects the diagnostics of a rule set
+type validator struct {
+	o           *options
+	diagnostics Diagnostics
+}
+
+func (v *validator) warn(path, message string) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{Severity: SeverityWarning, Path: path, Message: message})
+}
+
+func (v *validator) fail(path string, err error) {
+	message := err.Error()
+	var ruleErr *RuleError
+	if errors.As(err, &ruleErr) {
+		message = ruleErr.Err.Error()
+	}
+	v.diagnostics = append(v.diagnostics, Diagnostic{Severity: SeverityError, Path: path, Message: message, Err: err})
+}
+
+// group checks a condition set, or a rule grouping nested rules
+func (v *validator) group(what string, all, any, none []Rule, not *Rule, path string) {
+	if len(all) == 0 && len(any) == 0 && len(none) == 0 && not == nil {
+		v.warn(path, fmt.Sprintf("empty %s always passes", what))
+	}
+	v.rules(all, path, "all")
+	v.rules(any, path, "any")
+	v.rules(none, path, "none")
+	if not != nil {
+		v.rule(*not, path+".not")
+	}
+	v.contradictions(all, path)
+}
+
+// rules checks the rules of a part of a group and the rules repeated in it
+func (v *validator) rules(rules []Rule, path, group string) {
+	seen := map[string]string{}
+	for i, rule := range rules {
+		rulePath := childPath(path, group, i)
+		v.rule(rule, rulePath)
+
+		key, err := json.Marshal(rule)
+		if err != nil {
+			continue
+		}
+		if first, exists := seen[string(key)]; exists {
+			v.warn(rulePath, fmt.Sprintf("duplicates %s", first))
+			continue
+		}
+		seen[string(key)] = rulePath
+	}
+}
+
+// rule checks a rule compiles, or checks the nested rules of a group
+func (v *validator) rule(rule Rule, path string) {
+	if err := rule.checkWindow(); err != nil {
+		v.fail(path, err)
+	}
+	if rule.IsGroup() {
+		v.group("group", rule.All, rule.Any, rule.None, rule.Not, path)
+		return
+	}
+	if r := compileRule(rule, path, v.o); r.err != nil {
+		v.fail(path, r.err)
+	}
+}
+
+// contradictions warns about the rules of an "all" part that can never pass together, e.g.
+// `x > 10` and `x < 5`
+func (v *validator) contradictions(rules []Rule, path string) {
+	fields := map[string]*fieldConstraints{}
+	for i, rule := range rules {
+		// a wildcard passes when any of its values passes, so its rules do not exclude each other
+		if rule.IsGroup() || strings.Contains(rule.Field, "[*]") || !v.builtin(rule.Operator) {
+			continue
+		}
+		c, exists := fields[rule.Field]
+		if !exists {
+			c = &fieldConstraints{}
+			fields[rule.Field] = c
+		}
+		rulePath := childPath(path, "all", i)
+		if other := c.add(rule, rulePath); other != "" {
+			v.warn(rulePath, fmt.Sprintf("contradicts %s, %s can never pass", other, path))
+		}
+	}
+}
+
+// builtin reports whether the operator is the built-in operator of the name, and not one
+// registered in its place
+func (v *validator) builtin(name string) bool {
+	builtin, exists := builtinRegistry.Lookup(name)
+	if !exists || v.o.registry == nil {
+		return exists
+	}
+	spec, exists := v.o.registry.Lookup(name)
+	return exists && reflect.TypeOf(spec.Operator) == reflect.TypeOf(builtin.Operator)
+}
+
+// fieldConstraints are the values a field can have for the rules of an "all" part to pass
+type fieldConstraints struct {
+	lower     *bound
+	upper     *bound
+	equals    *constraint
+	notEquals []constraint
+}
+
+// bound is a limit set by an ordering rule on a number
+type bound struct {
+	n         number
+	inclusive bool
+	path      string
+}
+
+// constraint is a value set by an equality rule
+type constraint struct {
+	value interface{}
+	path  string
+}
+
+// add narrows the constraints with a rule and returns the path of the rule it contradicts
+func (c *fieldConstraints) add(rule Rule, path string) string {
+	n, isNumber := toNumber(rule.Value, false)
+	switch rule.Operator {
+	case "equals":
+		if c.equals != nil && !valuesEqual(c.equals.value, rule.Value) {
+			return c.equals.path
+		}
+		for _, notEquals := range c.notEquals {
+			if valuesEqual(notEquals.value, rule.Value) {
+				return notEquals.path
+			}
+		}
+		c.equals = &constraint{value: rule.Value, path: path}
+		if isNumber {
+			return c.narrow(&bound{n, true, path}, &bound{n, true, path}, path)
+		}
+	case "notEquals":
+		if c.equals != nil && valuesEqual(c.equals.value, rule.Value) {
+			return c.equals.path
+		}
+		c.notEquals = append(c.notEquals, constraint{value: rule.Value, path: path})
+	case "greaterThan", "greaterThanInclusive":
+		if isNumber {
+			return c.narrow(&bound{n, rule.Operator == "greaterThanInclusive", path}, nil, path)
+		}
+	case "lessThan", "lessThanInclusive":
+		if isNumber {
+			return c.narrow(nil, &bound{n, rule.Operator == "lessThanInclusive", path}, path)
+		}
+	}
+	return ""
+}
+
+// narrow keeps the tighter bounds and returns the path of the other rule bounding the
+// field when no number is left between them
+func (c *fieldConstraints) narrow(lower, upper *bound, path string) string {
+	if lower != nil && (c.lower == nil || tighter(lower, c.lower, 1)) {
+		c.lower = lower
+	}
+	if upper != nil && (c.upper == nil || tighter(upper, c.upper, -1)) {
+		c.upper = upper
+	}
+	if c.lower == nil || c.upper == nil {
+		return ""
+	}
+	cmp := c.lower.n.compare(c.upper.n)
+	if cmp < 0 || cmp == 0 && c.lower.inclusive && c.upper.inclusive {
+		return ""
+	}
+	if c.lower.path != path {
+		return c.lower.path
+	}
+	return c.upper.path
+}
+
+// tighter reports whether b excludes more numbers than current, direction is 1 for lower
+// bounds and -1 for upper bounds
+func tighter(b, current *bound, direction int) bool {
+	cmp := b.n.compare(current.n) * direction
+	return cmp > 0 || cmp == 0 && current.inclusive && !b.inclusive
+}
@@ -0,0 +1,103 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	rule := func(rules string) string {
+		return `{"conditions":[{"all":[` + rules + `]}]}`
+	}
+
+	tests := []struct {
+		name        string
+		rules       string
+		diagnostics []Diagnostic
+	}{
+		{"valid", rule(`{"field":"country","operator":"equals","value":"Turkey"},{"field":"population","operator":"greaterThan","value":10}`), nil},
+		{"unknown operator", rule(`{"field":"population","operator":"greaterthan","value":10}`), []Diagnostic{
+			{Severity: SeverityError, Path: "conditions[0].all[0]", Err: ErrUnknownOperator},
+		}},
+		{"custom operation", rule(`{"field":"external.score","operator":"custom.check","value":1}`), []Diagnostic{
+			{Severity: SeverityError, Path: "conditions[0].all[0]", Err: ErrCustomOperationNotFound},
+		}},
+		{"in without array", rule(`{"field":"country","operator":"in","value":"Turkey"}`), []Diagnostic{
+			{Severity: SeverityError, Path: "conditions[0].all[0]", Err: ErrTypeMismatch},
+		}},
+		{"invalid pattern", `{"conditions":[{"any":[{"field":"city","operator":"regex","value":"[a-"}]}]}`, []Diagnostic{
+			{Severity: SeverityError, Path: "conditions[0].any[0]", Err: ErrInvalidRules},
+		}},
+		{"no conditions", `{"conditions":[]}`, []Diagnostic{
+			{Severity: SeverityWarning, Path: "", Message: "no conditions"},
+		}},
+		{"empty condition set", `{"conditions":[{}]}`, []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0]", Message: "empty condition set"},
+		}},
+		{"empty group", rule(`{"any":[]}`), []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[0]", Message: "empty group"},
+		}},
+		{"contradictory range", rule(`{"field":"x","operator":"greaterThan","value":10},{"field":"x","operator":"lessThan","value":5}`), []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[1]", Message: "contradicts conditions[0].all[0]"},
+		}},
+		{"touching range", rule(`{"field":"x","operator":"greaterThanInclusive","value":5},{"field":"x","operator":"lessThanInclusive","value":5}`), nil},
+		{"empty range", rule(`{"field":"x","operator":"greaterThanInclusive","value":5},{"field":"x","operator":"lessThan","value":5}`), []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[1]", Message: "contradicts conditions[0].all[0]"},
+		}},
+		{"equals out of range", rule(`{"field":"x","operator":"lessThan","value":5},{"field":"y","operator":"equals","value":1},{"field":"x","operator":"equals","value":7}`), []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[2]", Message: "contradicts conditions[0].all[0]"},
+		}},
+		{"different equals", `{"conditions":[{"all":[{"all":[{"field":"country","operator":"equals","value":"Turkey"},{"field":"country","operator":"equals","value":"England"}]}]}]}`, []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[0].all[1]", Message: "contradicts conditions[0].all[0].all[0]"},
+		}},
+		{"equals and notEquals", rule(`{"field":"country","operator":"notEquals","value":"Turkey"},{"field":"country","operator":"equals","value":"Turkey"}`), []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].all[1]", Message: "contradicts conditions[0].all[0]"},
+		}},
+		{"wildcard", rule(`{"field":"items[*].price","operator":"greaterThan","value":10},{"field":"items[*].price","operator":"lessThan","value":5}`), nil},
+		{"any is not contradictory", `{"conditions":[{"any":[{"field":"x","operator":"greaterThan","value":10},{"field":"x","operator":"lessThan","value":5}]}]}`, nil},
+		{"duplicate", `{"conditions":[{"any":[{"field":"x","operator":"equals","value":1},{"field":"y","operator":"equals","value":1},{"field":"x","operator":"equals","value":1}]}]}`, []Diagnostic{
+			{Severity: SeverityWarning, Path: "conditions[0].any[2]", Message: "duplicates conditions[0].any[0]"},
+		}},
+	}
+
+	for _, test := range tests {
+		var ruleSet RuleSet
+		if err := json.Unmarshal([]byte(test.rules), &ruleSet); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		diagnostics := Validate(ruleSet)
+		if len(diagnostics) != len(test.diagnostics) {
+			t.Errorf("%s: Validate() = %v; expected %d diagnostics", test.name, diagnostics, len(test.diagnostics))
+			continue
+		}
+		for i, diagnostic := range diagnostics {
+			expected := test.diagnostics[i]
+			if diagnostic.Severity != expected.Severity || diagnostic.Path != expected.Path ||
+				!strings.Contains(diagnostic.Message, expected.Message) || !errors.Is(diagnostic.Err, expected.Err) {
+				t.Errorf("%s: diagnostic = %v (%v); expected %+v", test.name, diagnostic, diagnostic.Err, expected)
+			}
+		}
+		if diagnostics.HasErrors() != (len(test.diagnostics) > 0 && test.diagnostics[0].Severity == SeverityError) {
+			t.Errorf("%s: HasErrors() = %v", test.name, diagnostics.HasErrors())
+		}
+	}
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	ruleSet := RuleSet{Conditions: []ConditionSet{{All: []Rule{
+		{Field: "external.score", Operator: "custom.check", Value: 1},
+		{Field: "country", Operator: "equals", Value: "Turkey"},
+		{Field: "country", Operator: "equals", Value: "TURKEY"},
+	}}}}
+	registry := NewRegistry()
+	if err := registry.RegisterOperator("equals", EqualFoldOperator{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diagnostics := Validate(ruleSet, WithCustom(map[string]CustomOperation{"score": &CustomInput{}, "check": &CustomControl{}}), WithRegistry(registry))
+	if len(diagnostics) != 0 {
+		t.Errorf("Validate() = %v; expected custom operations and registered operators to be known", diagnostics)
+	}
+}